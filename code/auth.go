@@ -0,0 +1,239 @@
+package common
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	gogithub "github.com/google/go-github/v62/github"
+)
+
+// TokenSource provides the token used for the API and git of repositories of owner.
+type TokenSource interface {
+	Token(owner string) (string, error)
+}
+
+// lazyTokenSource is only created once a token is needed, so that commands that do not use e.g.
+// the approver do not need its credentials.
+type lazyTokenSource struct {
+	once   sync.Once
+	create func() (TokenSource, error)
+	source TokenSource
+	err    error
+}
+
+func (lazy *lazyTokenSource) Token(owner string) (string, error) {
+	lazy.once.Do(func() {
+		lazy.source, lazy.err = lazy.create()
+	})
+	if lazy.err != nil {
+		return "", lazy.err
+	}
+
+	return lazy.source.Token(owner)
+}
+
+// StaticToken is the same token for every owner, e.g. a personal access token.
+type StaticToken string
+
+func (token StaticToken) Token(owner string) (string, error) {
+	return string(token), nil
+}
+
+// Installation tokens are valid for an hour, and are replaced a while before they expire so that
+// they do not expire in the middle of a clone or push.
+const installationTokenRefreshMargin = 10 * time.Minute
+
+// AppTokenSource authenticates as a GitHub App, and gets a token of the installation of the app
+// for every owner. See https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app.
+type AppTokenSource struct {
+	AppId      string
+	PrivateKey *rsa.PrivateKey
+
+	client        *gogithub.Client
+	mutex         sync.Mutex
+	installations map[string]int64
+	tokens        map[string]*gogithub.InstallationToken
+}
+
+// NewAppTokenSource accepts the app ID or client ID, and the private key in PEM format as it is
+// downloaded from GitHub.
+func NewAppTokenSource(host string, appId string, privateKeyPem string) (*AppTokenSource, error) {
+	privateKey, err := parsePrivateKey(privateKeyPem)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key of GitHub App '%s': %w", appId, err)
+	}
+
+	client, err := newRetryingClient(host)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AppTokenSource{
+		AppId:         appId,
+		PrivateKey:    privateKey,
+		client:        client,
+		installations: map[string]int64{},
+		tokens:        map[string]*gogithub.InstallationToken{},
+	}, nil
+}
+
+func parsePrivateKey(privateKeyPem string) (*rsa.PrivateKey, error) {
+	// Secrets are sometimes stored with escaped line breaks.
+	block, _ := pem.Decode([]byte(strings.ReplaceAll(privateKeyPem, `\n`, "\n")))
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return privateKey, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, isRsa := key.(*rsa.PrivateKey)
+	if !isRsa {
+		return nil, errors.New("private key is not an RSA key")
+	}
+
+	return privateKey, nil
+}
+
+// jwt signs a JSON Web Token that authenticates as the app itself for the next few minutes. It is
+// issued a minute in the past to allow for clock drift.
+func (source *AppTokenSource) jwt() (string, error) {
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": source.AppId,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, source.PrivateKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("could not sign JWT: %w", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (source *AppTokenSource) Token(owner string) (string, error) {
+	if owner == "" {
+		return "", errors.New("an installation token needs the owner of the repository")
+	}
+
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	if token, exists := source.tokens[owner]; exists && time.Until(token.GetExpiresAt().Time) > installationTokenRefreshMargin {
+		return token.GetToken(), nil
+	}
+
+	jwt, err := source.jwt()
+	if err != nil {
+		return "", err
+	}
+	appClient := source.client.WithAuthToken(jwt)
+
+	installationId, err := source.getInstallationId(appClient, owner)
+	if err != nil {
+		return "", err
+	}
+
+	token, _, err := appClient.Apps.CreateInstallationToken(context.Background(), installationId, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not create installation token of GitHub App '%s' for '%s': %w", source.AppId, owner, err)
+	}
+
+	Secrets.Add(token.GetToken())
+	source.tokens[owner] = token
+	log.Printf("Created installation token for '%s', valid until %s\n", owner, token.GetExpiresAt().Format(time.RFC3339))
+
+	return token.GetToken(), nil
+}
+
+// getInstallationId finds the installation of the app on an organization, or else on a user.
+func (source *AppTokenSource) getInstallationId(appClient *gogithub.Client, owner string) (int64, error) {
+	if installationId, exists := source.installations[owner]; exists {
+		return installationId, nil
+	}
+
+	ctx := context.Background()
+	installation, response, err := appClient.Apps.FindOrganizationInstallation(ctx, owner)
+	if response != nil && response.StatusCode == http.StatusNotFound {
+		installation, _, err = appClient.Apps.FindUserInstallation(ctx, owner)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not find installation of GitHub App '%s' for '%s': %w", source.AppId, owner, err)
+	}
+
+	source.installations[owner] = installation.GetID()
+	return installation.GetID(), nil
+}
+
+// tokenTransport authenticates every request with the token for the owner of the repository it
+// is about. Requests without a repository in their path, e.g. GraphQL, need the owner in their
+// context, see ContextWithOwner.
+type tokenTransport struct {
+	base   http.RoundTripper
+	source TokenSource
+}
+
+type ownerContextKey struct{}
+
+func ContextWithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerContextKey{}, owner)
+}
+
+func requestOwner(request *http.Request) string {
+	if owner, exists := request.Context().Value(ownerContextKey{}).(string); exists {
+		return owner
+	}
+
+	segments := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+	for index, segment := range segments {
+		if segment == "repos" && index+1 < len(segments) {
+			return segments[index+1]
+		}
+	}
+
+	return ""
+}
+
+func (transport *tokenTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	token, err := transport.source.Token(requestOwner(request))
+	if err != nil {
+		return nil, err
+	}
+
+	authenticated := request.Clone(request.Context())
+	authenticated.Header.Set("Authorization", "Bearer "+token)
+
+	return transport.base.RoundTrip(authenticated)
+}
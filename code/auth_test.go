@@ -0,0 +1,145 @@
+package common
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gogithub "github.com/google/go-github/v62/github"
+)
+
+func TestRequestOwner(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		owner    string
+		expected string
+	}{
+		{"repository", "https://api.github.com/repos/org/component/pulls/1", "", "org"},
+		{"GitHub Enterprise Server", "https://ghes.example.com/api/v3/repos/org/component/contents/sync.yaml", "", "org"},
+		{"owner in the context", "https://api.github.com/graphql", "org", "org"},
+		{"context before path", "https://api.github.com/repos/other/component", "org", "org"},
+		{"no repository", "https://api.github.com/graphql", "", ""},
+		{"incomplete path", "https://api.github.com/repos", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.owner != "" {
+				ctx = ContextWithOwner(ctx, test.owner)
+			}
+			request, err := http.NewRequestWithContext(ctx, http.MethodGet, test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if owner := requestOwner(request); owner != test.expected {
+				t.Errorf("requestOwner() = %q, expected %q", owner, test.expected)
+			}
+		})
+	}
+}
+
+// ownerTokens has a token for every owner, like the installations of a GitHub App.
+type ownerTokens map[string]string
+
+func (tokens ownerTokens) Token(owner string) (string, error) {
+	return tokens[owner], nil
+}
+
+func TestTokenTransportAuthenticatesForOwner(t *testing.T) {
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		authorizations = append(authorizations, request.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &tokenTransport{base: http.DefaultTransport, source: ownerTokens{"org": "org-token", "user": "user-token"}}}
+	for _, path := range []string{"/repos/org/component", "/repos/user/component/pulls"} {
+		response, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Get() returned an error: %v", err)
+		}
+		response.Body.Close()
+	}
+
+	if strings.Join(authorizations, ", ") != "Bearer org-token, Bearer user-token" {
+		t.Errorf("requests were authorized with %q", authorizations)
+	}
+}
+
+func TestAppTokenSourceSelectsInstallationByOwner(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokenRequests []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/orgs/{owner}/installation", func(writer http.ResponseWriter, request *http.Request) {
+		if request.PathValue("owner") != "org" {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(writer).Encode(&gogithub.Installation{ID: gogithub.Int64(1)})
+	})
+	mux.HandleFunc("GET /api/v3/users/{owner}/installation", func(writer http.ResponseWriter, request *http.Request) {
+		json.NewEncoder(writer).Encode(&gogithub.Installation{ID: gogithub.Int64(2)})
+	})
+	mux.HandleFunc("POST /api/v3/app/installations/{id}/access_tokens", func(writer http.ResponseWriter, request *http.Request) {
+		if !strings.HasPrefix(request.Header.Get("Authorization"), "Bearer ") {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		tokenRequests = append(tokenRequests, request.PathValue("id"))
+		writer.WriteHeader(http.StatusCreated)
+		json.NewEncoder(writer).Encode(&gogithub.InstallationToken{
+			Token:     gogithub.String("ghs_installation-token-" + request.PathValue("id")),
+			ExpiresAt: &gogithub.Timestamp{Time: time.Now().Add(time.Hour)},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := gogithub.NewClient(nil).WithEnterpriseURLs(server.URL, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &AppTokenSource{
+		AppId:         "123",
+		PrivateKey:    privateKey,
+		client:        client,
+		installations: map[string]int64{},
+		tokens:        map[string]*gogithub.InstallationToken{},
+	}
+
+	tests := []struct {
+		owner    string
+		expected string
+	}{
+		{"org", "ghs_installation-token-1"},
+		{"user", "ghs_installation-token-2"},
+		{"org", "ghs_installation-token-1"},
+	}
+	for _, test := range tests {
+		if token, err := source.Token(test.owner); err != nil || token != test.expected {
+			t.Errorf("Token(%q) = %q (%v), expected %q", test.owner, token, err, test.expected)
+		}
+	}
+
+	// The token of "org" is still valid, so it is reused.
+	if strings.Join(tokenRequests, ", ") != "1, 2" {
+		t.Errorf("tokens were created for installations %q, expected 1 and 2", tokenRequests)
+	}
+	if _, err := source.Token(""); err == nil {
+		t.Errorf("Token() without an owner did not return an error")
+	}
+}
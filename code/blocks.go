@@ -0,0 +1,121 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+const DefaultBlockComment = "#"
+
+// BlockMarkers delimit the region of a file that is managed by the sync, e.g. "# BEGIN synced:
+// common" and "# END synced". Everything outside of the markers belongs to the repository.
+type BlockMarkers struct {
+	Begin string `json:"begin"`
+	End   string `json:"end"`
+}
+
+// NewBlockMarkers builds the markers from the comment syntax of the file, which is either a line
+// comment (e.g. "#" or "//") or the start and end of a comment separated by a space (e.g.
+// "<!-- -->").
+func NewBlockMarkers(comment string, name string) BlockMarkers {
+	commentStart, commentEnd, _ := strings.Cut(strings.TrimSpace(comment), " ")
+	if commentEnd = strings.TrimSpace(commentEnd); commentEnd != "" {
+		commentEnd = " " + commentEnd
+	}
+
+	return BlockMarkers{
+		Begin: fmt.Sprintf("%s BEGIN synced: %s%s", commentStart, name, commentEnd),
+		End:   fmt.Sprintf("%s END synced%s", commentStart, commentEnd),
+	}
+}
+
+func isValidBlockComment(comment string) bool {
+	fields := strings.Fields(comment)
+	return len(fields) == 1 || len(fields) == 2
+}
+
+// findManagedBlock returns the offsets of the contents between the markers, or -1 if there is no
+// managed block. A begin marker without an end marker, or more than one managed block, is an
+// error, since replacing the wrong lines would throw away whatever the repository added there.
+// Other end markers are left alone, since the blocks of every source end the same way.
+func findManagedBlock(contents string, markers BlockMarkers) (int, int, error) {
+	blockStart, blockEnd := -1, -1
+	for lineStart := 0; lineStart < len(contents); {
+		lineEnd := strings.IndexByte(contents[lineStart:], '\n') + lineStart + 1
+		if lineEnd == lineStart {
+			lineEnd = len(contents)
+		}
+		line := strings.TrimSpace(contents[lineStart:lineEnd])
+
+		switch {
+		case line == markers.Begin && blockEnd >= 0:
+			return -1, -1, fmt.Errorf("found a second '%s', only one managed block is supported", markers.Begin)
+		case line == markers.Begin && blockStart >= 0:
+			return -1, -1, fmt.Errorf("found a second '%s' before '%s'", markers.Begin, markers.End)
+		case line == markers.Begin:
+			blockStart = lineEnd
+		case line == markers.End && blockStart >= 0 && blockEnd < 0:
+			blockEnd = lineStart
+		}
+
+		lineStart = lineEnd
+	}
+
+	if blockStart >= 0 && blockEnd < 0 {
+		return -1, -1, fmt.Errorf("found '%s' without '%s'", markers.Begin, markers.End)
+	}
+
+	return blockStart, blockEnd, nil
+}
+
+// readManagedBlock returns the contents between the markers as they were rendered, and whether
+// there is a managed block at all.
+func readManagedBlock(contents string, markers BlockMarkers) (string, bool, error) {
+	blockStart, blockEnd, err := findManagedBlock(contents, markers)
+	if err != nil || blockStart < 0 {
+		return "", false, err
+	}
+
+	return normalizeBlock(contents[blockStart:blockEnd]), true, nil
+}
+
+// normalizeBlock ends the block with a newline and uses "\n" line endings, which the file may
+// replace with its own.
+func normalizeBlock(block string) string {
+	block = strings.ReplaceAll(block, "\r\n", "\n")
+	if block != "" && !strings.HasSuffix(block, "\n") {
+		return block + "\n"
+	}
+
+	return block
+}
+
+// ReplaceManagedBlock replaces the contents between the markers with block, leaving the rest of
+// the file alone. Without a managed block, one is appended to the end of the file. The block gets
+// the line endings of the file, so files with "\r\n" line endings keep them.
+func ReplaceManagedBlock(contents string, block string, markers BlockMarkers) (string, error) {
+	lineEnding := "\n"
+	if strings.Contains(contents, "\r\n") {
+		lineEnding = "\r\n"
+	}
+	block = strings.ReplaceAll(normalizeBlock(block), "\n", lineEnding)
+
+	blockStart, blockEnd, err := findManagedBlock(contents, markers)
+	if err != nil {
+		return "", err
+	}
+	if blockStart >= 0 {
+		return contents[:blockStart] + block + contents[blockEnd:], nil
+	}
+
+	if contents != "" {
+		if !strings.HasSuffix(contents, "\n") {
+			contents += lineEnding
+		}
+		if !strings.HasSuffix(contents, lineEnding+lineEnding) {
+			contents += lineEnding
+		}
+	}
+
+	return contents + markers.Begin + lineEnding + block + markers.End + lineEnding, nil
+}
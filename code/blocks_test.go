@@ -0,0 +1,156 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewBlockMarkers(t *testing.T) {
+	tests := []struct {
+		comment  string
+		expected BlockMarkers
+	}{
+		{"#", BlockMarkers{Begin: "# BEGIN synced: org/common", End: "# END synced"}},
+		{"//", BlockMarkers{Begin: "// BEGIN synced: org/common", End: "// END synced"}},
+		{"<!-- -->", BlockMarkers{Begin: "<!-- BEGIN synced: org/common -->", End: "<!-- END synced -->"}},
+	}
+
+	for _, test := range tests {
+		if markers := NewBlockMarkers(test.comment, "org/common"); markers != test.expected {
+			t.Errorf("NewBlockMarkers(%q) = %+v, expected %+v", test.comment, markers, test.expected)
+		}
+	}
+}
+
+func TestReplaceManagedBlock(t *testing.T) {
+	markers := NewBlockMarkers("#", "org/common")
+
+	tests := []struct {
+		name     string
+		contents string
+		block    string
+		expected string
+	}{
+		{
+			name:     "empty file",
+			contents: "",
+			block:    "managed: true",
+			expected: "# BEGIN synced: org/common\nmanaged: true\n# END synced\n",
+		},
+		{
+			name:     "no managed block",
+			contents: "owned: true",
+			block:    "managed: true\n",
+			expected: "owned: true\n\n# BEGIN synced: org/common\nmanaged: true\n# END synced\n",
+		},
+		{
+			name:     "replaced block",
+			contents: "before: true\n# BEGIN synced: org/common\nmanaged: false\nstale: true\n# END synced\nafter: true\n",
+			block:    "managed: true\n",
+			expected: "before: true\n# BEGIN synced: org/common\nmanaged: true\n# END synced\nafter: true\n",
+		},
+		{
+			name:     "indented markers",
+			contents: "jobs:\n  # BEGIN synced: org/common\n  build: {}\n  # END synced\n",
+			block:    "  test: {}\n",
+			expected: "jobs:\n  # BEGIN synced: org/common\n  test: {}\n  # END synced\n",
+		},
+		{
+			name:     "markers of another source",
+			contents: "# BEGIN synced: org/other\nother: true\n# END synced\n",
+			block:    "managed: true\n",
+			expected: "# BEGIN synced: org/other\nother: true\n# END synced\n\n# BEGIN synced: org/common\nmanaged: true\n# END synced\n",
+		},
+		{
+			name:     "missing begin marker",
+			contents: "owned: true\nmanaged: false\n# END synced\n",
+			block:    "managed: true\n",
+			expected: "owned: true\nmanaged: false\n# END synced\n\n# BEGIN synced: org/common\nmanaged: true\n# END synced\n",
+		},
+		{
+			name:     "CRLF file",
+			contents: "before: true\r\n# BEGIN synced: org/common\r\nmanaged: false\r\n# END synced\r\nafter: true\r\n",
+			block:    "managed: true\nsecond: true\n",
+			expected: "before: true\r\n# BEGIN synced: org/common\r\nmanaged: true\r\nsecond: true\r\n# END synced\r\nafter: true\r\n",
+		},
+		{
+			name:     "CRLF file without a managed block",
+			contents: "owned: true\r\n",
+			block:    "managed: true\r\n",
+			expected: "owned: true\r\n\r\n# BEGIN synced: org/common\r\nmanaged: true\r\n# END synced\r\n",
+		},
+		{
+			name:     "CRLF block in an LF file",
+			contents: "# BEGIN synced: org/common\n# END synced\n",
+			block:    "managed: true\r\n",
+			expected: "# BEGIN synced: org/common\nmanaged: true\n# END synced\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replaced, err := ReplaceManagedBlock(test.contents, test.block, markers)
+			if err != nil {
+				t.Fatalf("ReplaceManagedBlock() returned an error: %v", err)
+			}
+
+			if replaced != test.expected {
+				t.Errorf("ReplaceManagedBlock() returned %q, expected %q", replaced, test.expected)
+			}
+
+			// Replacing the block again finds the block that was just written.
+			if again, err := ReplaceManagedBlock(replaced, test.block, markers); err != nil || again != replaced {
+				t.Errorf("ReplaceManagedBlock() of its own result returned %q (%v)", again, err)
+			}
+		})
+	}
+}
+
+func TestReplaceManagedBlockReportsInvalidMarkers(t *testing.T) {
+	markers := NewBlockMarkers("#", "org/common")
+
+	tests := []struct {
+		name     string
+		contents string
+		problem  string
+	}{
+		{
+			name:     "missing end marker",
+			contents: "# BEGIN synced: org/common\nmanaged: true\nowned: true\n",
+			problem:  "found '# BEGIN synced: org/common' without '# END synced'",
+		},
+		{
+			name:     "nested markers",
+			contents: "# BEGIN synced: org/common\n# BEGIN synced: org/common\nmanaged: true\n# END synced\n# END synced\n",
+			problem:  "found a second '# BEGIN synced: org/common' before '# END synced'",
+		},
+		{
+			name:     "duplicated block",
+			contents: "# BEGIN synced: org/common\nmanaged: true\n# END synced\nowned: true\n# BEGIN synced: org/common\nmanaged: true\n# END synced\n",
+			problem:  "found a second '# BEGIN synced: org/common', only one managed block is supported",
+		},
+		{
+			name:     "missing end marker in a CRLF file",
+			contents: "# BEGIN synced: org/common\r\nmanaged: true\r\n",
+			problem:  "without '# END synced'",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReplaceManagedBlock(test.contents, "managed: true\n", markers)
+			if err == nil || !strings.Contains(err.Error(), test.problem) {
+				t.Errorf("ReplaceManagedBlock() returned %v, expected an error containing %q", err, test.problem)
+			}
+		})
+	}
+}
+
+func TestReadManagedBlockOfCRLFFile(t *testing.T) {
+	markers := NewBlockMarkers("<!-- -->", "org/common")
+
+	block, found, err := readManagedBlock("# Title\r\n<!-- BEGIN synced: org/common -->\r\nmanaged\r\n<!-- END synced -->\r\n", markers)
+	if err != nil || !found || block != "managed\n" {
+		t.Errorf("readManagedBlock() returned %q, %v, %v, expected the block with \"\\n\" line endings", block, found, err)
+	}
+}
@@ -0,0 +1,151 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+const maxChecksInterval = 2 * time.Minute
+
+const (
+	CheckPending = "pending"
+	CheckSuccess = "success"
+	CheckFailure = "failure"
+)
+
+// CheckResult combines check runs (e.g. GitHub Actions) and commit statuses (e.g. external CI).
+type CheckResult struct {
+	Name   string
+	State  string
+	Detail string
+	URL    string
+}
+
+func checkRunState(status string, conclusion string) string {
+	if status != "completed" {
+		return CheckPending
+	}
+
+	switch conclusion {
+	case "success", "neutral", "skipped":
+		return CheckSuccess
+	}
+
+	return CheckFailure
+}
+
+func commitStatusState(state string) string {
+	switch state {
+	case "success":
+		return CheckSuccess
+	case "pending":
+		return CheckPending
+	}
+
+	return CheckFailure
+}
+
+func GetChecks(api GitHubAPI, owner string, name string, ref string) ([]CheckResult, error) {
+	ctx := context.Background()
+
+	checkRuns, err := api.ListCheckRuns(ctx, owner, name, ref)
+	if err != nil {
+		return nil, fmt.Errorf("could not list check runs of '%s' in '%s/%s': %w", ref, owner, name, err)
+	}
+
+	combinedStatus, err := api.GetCombinedStatus(ctx, owner, name, ref)
+	if err != nil {
+		return nil, fmt.Errorf("could not get commit statuses of '%s' in '%s/%s': %w", ref, owner, name, err)
+	}
+
+	var checks []CheckResult
+	for _, checkRun := range checkRuns {
+		detail := checkRun.GetStatus()
+		if checkRun.GetStatus() == "completed" {
+			detail = checkRun.GetConclusion()
+		}
+
+		checks = append(checks, CheckResult{
+			Name:   checkRun.GetName(),
+			State:  checkRunState(checkRun.GetStatus(), checkRun.GetConclusion()),
+			Detail: detail,
+			URL:    checkRun.GetHTMLURL(),
+		})
+	}
+	for _, status := range combinedStatus.Statuses {
+		checks = append(checks, CheckResult{
+			Name:   status.GetContext(),
+			State:  commitStatusState(status.GetState()),
+			Detail: status.GetState(),
+			URL:    status.GetTargetURL(),
+		})
+	}
+
+	return checks, nil
+}
+
+// EvaluateChecks returns the checks that are still pending and the checks that failed. Required
+// checks that were not reported yet count as pending, since they may not have started yet.
+func EvaluateChecks(checks []CheckResult, required []string) ([]CheckResult, []CheckResult) {
+	var pending, failing []CheckResult
+	for _, check := range checks {
+		if len(required) > 0 && !slices.Contains(required, check.Name) {
+			continue
+		}
+
+		switch check.State {
+		case CheckPending:
+			pending = append(pending, check)
+		case CheckFailure:
+			failing = append(failing, check)
+		}
+	}
+
+	for _, name := range required {
+		reported := slices.ContainsFunc(checks, func(check CheckResult) bool {
+			return check.Name == name
+		})
+		if !reported {
+			pending = append(pending, CheckResult{Name: name, State: CheckPending, Detail: "expected"})
+		}
+	}
+
+	return pending, failing
+}
+
+// WaitForChecks polls the checks of ref until they all pass, one of them fails or the timeout
+// passes, doubling the interval between polls up to a maximum. Without required checks, ref only
+// passes without any checks once the grace period passes. It returns the checks that did not
+// pass, which are empty when ref can be merged.
+func WaitForChecks(api GitHubAPI, owner string, name string, ref string, config ChecksConfig) ([]CheckResult, error) {
+	graceDeadline := time.Now().Add(config.GraceDuration())
+	deadline := time.Now().Add(config.TimeoutDuration())
+	interval := config.IntervalDuration()
+
+	for {
+		checks, err := GetChecks(api, owner, name, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		pending, failing := EvaluateChecks(checks, config.Required)
+		if len(checks) == 0 && len(config.Required) == 0 && time.Now().Before(graceDeadline) {
+			pending = []CheckResult{{Name: "any check", State: CheckPending, Detail: "not reported yet"}}
+		}
+
+		if len(failing) > 0 {
+			return append(failing, pending...), nil
+		} else if len(pending) == 0 {
+			return nil, nil
+		} else if time.Now().Add(interval).After(deadline) {
+			return pending, nil
+		}
+
+		log.Printf("- Waiting %s for %v pending check(s)...\n", interval, len(pending))
+		time.Sleep(interval)
+		interval = min(interval*2, maxChecksInterval)
+	}
+}
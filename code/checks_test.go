@@ -0,0 +1,76 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/workflow-sync-poc/common/code/githubfake"
+)
+
+func TestEvaluateChecks(t *testing.T) {
+	checks := []CheckResult{
+		{Name: "build", State: CheckSuccess},
+		{Name: "lint", State: CheckFailure},
+		{Name: "test", State: CheckPending},
+	}
+
+	pending, failing := EvaluateChecks(checks, nil)
+	if len(pending) != 1 || pending[0].Name != "test" || len(failing) != 1 || failing[0].Name != "lint" {
+		t.Errorf("EvaluateChecks() without required checks returned pending %+v and failing %+v", pending, failing)
+	}
+
+	pending, failing = EvaluateChecks(checks, []string{"build", "deploy"})
+	if len(pending) != 1 || pending[0].Name != "deploy" || len(failing) != 0 {
+		t.Errorf("EvaluateChecks() with required checks returned pending %+v and failing %+v", pending, failing)
+	}
+}
+
+func TestWaitForChecksWithoutReportedChecks(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ChecksConfig
+		pending bool
+	}{
+		{"grace period passes", ChecksConfig{Timeout: "1s", Interval: "10ms", Grace: "50ms"}, false},
+		{"no grace period", ChecksConfig{Timeout: "1s", Interval: "10ms", Grace: "0s"}, false},
+		{"timeout before the grace period", ChecksConfig{Timeout: "50ms", Interval: "10ms", Grace: "1m"}, true},
+		{"required check", ChecksConfig{Required: []string{"build"}, Timeout: "50ms", Interval: "10ms", Grace: "0s"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := githubfake.NewServer()
+			t.Cleanup(server.Close)
+			server.AddRepository("org", "component", "main", "")
+
+			started := time.Now()
+			failingChecks, err := WaitForChecks(NewGitHubClient(server.Client()), "org", "component", "sync-workflows", test.config)
+			if err != nil {
+				t.Fatalf("WaitForChecks() returned an error: %v", err)
+			}
+
+			if pending := len(failingChecks) > 0; pending != test.pending {
+				t.Errorf("WaitForChecks() returned %+v, expected pending checks: %v", failingChecks, test.pending)
+			}
+			if !test.pending && time.Since(started) < test.config.GraceDuration() {
+				t.Errorf("WaitForChecks() passed before the grace period of %s", test.config.Grace)
+			}
+		})
+	}
+}
+
+func TestWaitForChecksAfterChecksAreReported(t *testing.T) {
+	server := githubfake.NewServer()
+	t.Cleanup(server.Close)
+	server.AddRepository("org", "component", "main", "")
+	server.AddCheckRun("org/component", "sync-workflows", "build", "completed", "success")
+
+	started := time.Now()
+	failingChecks, err := WaitForChecks(NewGitHubClient(server.Client()), "org", "component", "sync-workflows", ChecksConfig{Timeout: "1s", Interval: "10ms", Grace: "1m"})
+	if err != nil || len(failingChecks) > 0 {
+		t.Errorf("WaitForChecks() returned %+v (%v), expected the reported checks to pass", failingChecks, err)
+	}
+	if time.Since(started) > time.Second {
+		t.Errorf("WaitForChecks() waited for the grace period, although a check was reported")
+	}
+}
@@ -1,11 +1,24 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 
 	common "github.com/workflow-sync-poc/common/code"
 )
 
 func main() {
-	common.WriteJobSummary(fmt.Sprintf("### Executed Go File from `%s`", common.GetEnv("GO_FILE_REF")))
+	if err := common.SetupRedaction(); err != nil {
+		common.Exit(nil, "code-1", err)
+	}
+
+	configFlags := common.RegisterConfigFlags(flag.CommandLine)
+	flag.Parse()
+
+	config, err := configFlags.Load()
+	if err != nil {
+		common.Exit(nil, "code-1", err)
+	}
+
+	common.Exit(config, "code-1", common.WriteJobSummary(config, fmt.Sprintf("### Executed Go File from `%s`", config.SourceRef)))
 }
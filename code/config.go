@@ -0,0 +1,283 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is everything the commands need to know about their environment. It is loaded from a
+// YAML file, then environment variables, then flags, each overriding the ones before.
+type Config struct {
+	// Host is the GitHub instance, e.g. "github.example.com" for GitHub Enterprise Server.
+	Host string `yaml:"host"`
+	// SourceRepository is the repository that is synced from, i.e. "owner/name".
+	SourceRepository string `yaml:"sourceRepository"`
+	SourceRef        string `yaml:"sourceRef"`
+	WorkflowRunId    int64  `yaml:"workflowRunId"`
+	// The job summary and output are written to the log when they have no path, e.g. outside of
+	// GitHub Actions.
+	SummaryPath string     `yaml:"summaryPath"`
+	OutputPath  string     `yaml:"outputPath"`
+	GitUser     GitUser    `yaml:"gitUser"`
+	Auth        AuthConfig `yaml:"auth"`
+	// A pull request cannot be approved by its author, so the approver is a different app or user.
+	Approver AuthConfig `yaml:"approver"`
+
+	Tokens         TokenSource `yaml:"-"`
+	ApproverTokens TokenSource `yaml:"-"`
+}
+
+type GitUser struct {
+	Name  string `yaml:"name"`
+	Email string `yaml:"email"`
+}
+
+// AuthConfig authenticates as the GitHub App with AppId if it is set, or else with Token.
+type AuthConfig struct {
+	AppId      string `yaml:"appId"`
+	PrivateKey string `yaml:"privateKey"`
+	Token      string `yaml:"token"`
+}
+
+func (auth AuthConfig) isConfigured() bool {
+	return auth.AppId != "" || auth.Token != ""
+}
+
+func (auth AuthConfig) newTokenSource(host string) TokenSource {
+	return &lazyTokenSource{create: func() (TokenSource, error) {
+		if auth.AppId != "" {
+			return NewAppTokenSource(host, auth.AppId, auth.PrivateKey)
+		}
+		if auth.Token != "" {
+			return StaticToken(auth.Token), nil
+		}
+
+		return nil, errors.New("no GitHub App or token is configured")
+	}}
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Host:    DefaultGitHubHost,
+		GitUser: GitUser{Name: "workflow-sync-bot", Email: "workflow-sync.bot@example.com"},
+	}
+}
+
+// ConfigNeed is a part of the configuration that a command cannot do without.
+type ConfigNeed int
+
+const (
+	NeedsAuth ConfigNeed = iota
+	NeedsApprover
+	NeedsWorkflowRun
+)
+
+// configEnv maps environment variables to the fields they set. Later variables take precedence.
+func configEnv(config *Config) []struct {
+	key   string
+	field *string
+} {
+	return []struct {
+		key   string
+		field *string
+	}{
+		{"GH_HOST", &config.Host},
+		{"GO_FILE_REPO", &config.SourceRepository},
+		{"GO_FILE_REF", &config.SourceRef},
+		{"GITHUB_STEP_SUMMARY", &config.SummaryPath},
+		{"GITHUB_OUTPUT", &config.OutputPath},
+		{"SYNC_GIT_USER_NAME", &config.GitUser.Name},
+		{"SYNC_GIT_USER_EMAIL", &config.GitUser.Email},
+		{"GH_APP_ID", &config.Auth.AppId},
+		{"GH_APP_PRIVATE_KEY", &config.Auth.PrivateKey},
+		{"GH_PAT_MF", &config.Auth.Token},
+		{"GH_APPROVER_APP_ID", &config.Approver.AppId},
+		{"GH_APPROVER_APP_PRIVATE_KEY", &config.Approver.PrivateKey},
+		{"GH_PAT_AYYXD", &config.Approver.Token},
+	}
+}
+
+// configFlagUsages are the flags that override the configuration, see RegisterConfigFlags.
+var configFlagUsages = []struct {
+	name  string
+	usage string
+}{
+	{"host", "the host of GitHub, e.g. \"github.example.com\" for GitHub Enterprise Server"},
+	{"source-repo", "the repository that is synced from, by default the origin of the working directory"},
+	{"run-id", "the ID of the workflow run, to record the sync run"},
+	{"summary-path", "the file to write the job summary to, by default the log"},
+	{"output-path", "the file to write the output to, by default the log"},
+	{"git-user-name", "the name of the git user that commits and tags"},
+	{"git-user-email", "the email of the git user that commits and tags"},
+}
+
+type ConfigFlags struct {
+	flags *flag.FlagSet
+	path  *string
+}
+
+func RegisterConfigFlags(flags *flag.FlagSet) *ConfigFlags {
+	for _, configFlag := range configFlagUsages {
+		flags.String(configFlag.name, "", configFlag.usage)
+	}
+
+	return &ConfigFlags{
+		flags: flags,
+		path:  flags.String("config", os.Getenv("SYNC_CONFIG"), "a YAML file with the configuration, overridden by environment variables and flags"),
+	}
+}
+
+// Load reads the configuration after the flags were parsed, and checks that it has what the
+// command needs. All problems are reported at once.
+func (configFlags *ConfigFlags) Load(needs ...ConfigNeed) (*Config, error) {
+	config := DefaultConfig()
+	var problems []error
+
+	// The server of the workflow run is only a default, unlike GH_HOST.
+	if serverUrl := os.Getenv("GITHUB_SERVER_URL"); serverUrl != "" {
+		config.Host = serverUrl
+	}
+
+	if *configFlags.path != "" {
+		if err := config.loadFile(*configFlags.path); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	runId := os.Getenv("GH_WORKFLOW_RUN_ID")
+	for _, env := range configEnv(config) {
+		if value := os.Getenv(env.key); value != "" {
+			*env.field = value
+		}
+	}
+
+	configFlags.flags.Visit(func(setFlag *flag.Flag) {
+		value := setFlag.Value.String()
+		switch setFlag.Name {
+		case "host":
+			config.Host = value
+		case "source-repo":
+			config.SourceRepository = value
+		case "run-id":
+			runId = value
+		case "summary-path":
+			config.SummaryPath = value
+		case "output-path":
+			config.OutputPath = value
+		case "git-user-name":
+			config.GitUser.Name = value
+		case "git-user-email":
+			config.GitUser.Email = value
+		}
+	})
+
+	if runId != "" {
+		parsedRunId, err := strconv.ParseInt(runId, 10, 64)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("workflow run ID '%s' is not a number", runId))
+		}
+		config.WorkflowRunId = parsedRunId
+	}
+
+	config.Host = normalizeHost(config.Host)
+	problems = append(problems, config.validate(needs)...)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(problems...))
+	}
+
+	for _, secret := range []string{config.Auth.Token, config.Auth.PrivateKey, config.Approver.Token, config.Approver.PrivateKey} {
+		Secrets.Add(secret)
+	}
+	config.Tokens = config.Auth.newTokenSource(config.Host)
+	config.ApproverTokens = config.Approver.newTokenSource(config.Host)
+
+	return config, nil
+}
+
+func (config *Config) loadFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file '%s': %w", path, err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("could not parse config file '%s': %w", path, err)
+	}
+
+	return nil
+}
+
+func (config *Config) validate(needs []ConfigNeed) []error {
+	var problems []error
+
+	if config.Host == "" || strings.ContainsAny(config.Host, "/ ") {
+		problems = append(problems, fmt.Errorf("host '%s' is not a host name (e.g. \"github.com\")", config.Host))
+	}
+	if config.SourceRepository != "" && !isRepoIdentifier(config.SourceRepository) {
+		problems = append(problems, fmt.Errorf("source repository '%s' is not in the format \"owner/name\"", config.SourceRepository))
+	}
+	if config.GitUser.Name == "" {
+		problems = append(problems, errors.New("git user has no name"))
+	}
+	if !strings.Contains(config.GitUser.Email, "@") {
+		problems = append(problems, fmt.Errorf("git user email '%s' is not an email address", config.GitUser.Email))
+	}
+
+	problems = append(problems, config.Auth.validate("GitHub App", "GH_APP_ID", "GH_APP_PRIVATE_KEY")...)
+	problems = append(problems, config.Approver.validate("approver GitHub App", "GH_APPROVER_APP_ID", "GH_APPROVER_APP_PRIVATE_KEY")...)
+
+	for _, need := range needs {
+		switch need {
+		case NeedsAuth:
+			if !config.Auth.isConfigured() {
+				problems = append(problems, errors.New("no GitHub App (GH_APP_ID) or token (GH_PAT_MF) is configured"))
+			}
+		case NeedsApprover:
+			if !config.Approver.isConfigured() {
+				problems = append(problems, errors.New("no approver GitHub App (GH_APPROVER_APP_ID) or token (GH_PAT_AYYXD) is configured"))
+			}
+		case NeedsWorkflowRun:
+			if config.WorkflowRunId == 0 {
+				problems = append(problems, errors.New("no workflow run ID (GH_WORKFLOW_RUN_ID) is configured"))
+			}
+		}
+	}
+
+	return problems
+}
+
+func (auth AuthConfig) validate(description string, appIdKey string, privateKeyKey string) []error {
+	if auth.AppId == "" {
+		if auth.PrivateKey != "" {
+			return []error{fmt.Errorf("%s has a private key (%s), but no ID (%s)", description, privateKeyKey, appIdKey)}
+		}
+		return nil
+	}
+
+	if auth.PrivateKey == "" {
+		return []error{fmt.Errorf("%s '%s' has no private key (%s)", description, auth.AppId, privateKeyKey)}
+	}
+	if _, err := parsePrivateKey(auth.PrivateKey); err != nil {
+		return []error{fmt.Errorf("private key of %s '%s' is invalid: %v", description, auth.AppId, err)}
+	}
+
+	return nil
+}
+
+// RemoteURL has no credentials, ExecGit authenticates when it talks to the remote.
+func (config *Config) RemoteURL(repository string) string {
+	return RepositoryURL(config.Host, repository) + ".git"
+}
+
+func (config *Config) GitBackend() GitBackend {
+	return ExecGit{Host: config.Host, Credentials: config.Tokens}
+}
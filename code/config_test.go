@@ -0,0 +1,144 @@
+package common
+
+import (
+	"errors"
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigFlagsLoad(t *testing.T) {
+	configFile := "host: 'file.example.com'\nsourceRepository: 'file/common'\nworkflowRunId: 1\nsummaryPath: 'file-summary.md'\noutputPath: 'file-output.txt'\ngitUser:\n  name: 'file-user'\n  email: 'file@example.com'\nauth:\n  token: 'file-token-value'\n"
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		expected Config
+		problems []string
+	}{
+		{
+			name: "file",
+			expected: Config{
+				Host: "file.example.com", SourceRepository: "file/common", WorkflowRunId: 1, SummaryPath: "file-summary.md", OutputPath: "file-output.txt",
+				GitUser: GitUser{Name: "file-user", Email: "file@example.com"}, Auth: AuthConfig{Token: "file-token-value"},
+			},
+		},
+		{
+			name: "environment over file",
+			env:  map[string]string{"GH_HOST": "https://env.example.com/", "GO_FILE_REPO": "env/common", "GH_WORKFLOW_RUN_ID": "2", "SYNC_GIT_USER_NAME": "env-user", "GH_PAT_MF": "env-token-value"},
+			expected: Config{
+				Host: "env.example.com", SourceRepository: "env/common", WorkflowRunId: 2, SummaryPath: "file-summary.md", OutputPath: "file-output.txt",
+				GitUser: GitUser{Name: "env-user", Email: "file@example.com"}, Auth: AuthConfig{Token: "env-token-value"},
+			},
+		},
+		{
+			name: "flags over environment and file",
+			env:  map[string]string{"GH_HOST": "env.example.com", "GO_FILE_REPO": "env/common", "GH_WORKFLOW_RUN_ID": "2", "SYNC_GIT_USER_NAME": "env-user", "GITHUB_OUTPUT": "env-output.txt"},
+			args: []string{"-host", "flag.example.com", "-source-repo", "flag/common", "-run-id", "3", "-git-user-name", "flag-user", "-summary-path", "flag-summary.md"},
+			expected: Config{
+				Host: "flag.example.com", SourceRepository: "flag/common", WorkflowRunId: 3, SummaryPath: "flag-summary.md", OutputPath: "env-output.txt",
+				GitUser: GitUser{Name: "flag-user", Email: "file@example.com"}, Auth: AuthConfig{Token: "file-token-value"},
+			},
+		},
+		{
+			name: "server of the workflow run is overridden by the file",
+			env:  map[string]string{"GITHUB_SERVER_URL": "https://server.example.com"},
+			expected: Config{
+				Host: "file.example.com", SourceRepository: "file/common", WorkflowRunId: 1, SummaryPath: "file-summary.md", OutputPath: "file-output.txt",
+				GitUser: GitUser{Name: "file-user", Email: "file@example.com"}, Auth: AuthConfig{Token: "file-token-value"},
+			},
+		},
+		{
+			name: "problems of every layer",
+			env:  map[string]string{"GO_FILE_REPO": "not-a-repository", "GH_WORKFLOW_RUN_ID": "latest", "GH_APP_PRIVATE_KEY": "private-key-value"},
+			args: []string{"-host", "flag.example.com/api", "-git-user-email", "nobody", "-git-user-name", ""},
+			problems: []string{
+				`host 'flag.example.com/api' is not a host name`,
+				`source repository 'not-a-repository' is not in the format "owner/name"`,
+				`workflow run ID 'latest' is not a number`,
+				`git user has no name`,
+				`git user email 'nobody' is not an email address`,
+				`GitHub App has a private key (GH_APP_PRIVATE_KEY), but no ID (GH_APP_ID)`,
+				`no approver GitHub App (GH_APPROVER_APP_ID) or token (GH_PAT_AYYXD) is configured`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := WriteFile(configPath, configFile); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, key := range []string{"GITHUB_SERVER_URL", "GH_WORKFLOW_RUN_ID", "SYNC_CONFIG"} {
+				t.Setenv(key, "")
+			}
+			for _, env := range configEnv(&Config{}) {
+				t.Setenv(env.key, "")
+			}
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			configFlags := RegisterConfigFlags(flags)
+			if err := flags.Parse(append([]string{"-config", configPath}, test.args...)); err != nil {
+				t.Fatal(err)
+			}
+
+			needs := []ConfigNeed{NeedsAuth}
+			if len(test.problems) > 0 {
+				needs = append(needs, NeedsApprover)
+			}
+			config, err := configFlags.Load(needs...)
+
+			if len(test.problems) > 0 {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Fatalf("Load() returned %v, expected ErrInvalidConfig", err)
+				}
+				for _, problem := range test.problems {
+					if !strings.Contains(err.Error(), problem) {
+						t.Errorf("Load() returned %q, expected it to contain %q", err, problem)
+					}
+				}
+				if problemCount := len(strings.Split(err.Error(), "\n")); problemCount != len(test.problems) {
+					t.Errorf("Load() reported %v problem(s), expected %v", problemCount, len(test.problems))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Load() returned an error: %v", err)
+			}
+			config.Tokens, config.ApproverTokens = nil, nil
+			if *config != test.expected {
+				t.Errorf("Load() = %+v, expected %+v", *config, test.expected)
+			}
+		})
+	}
+}
+
+func TestConfigFlagsLoadReportsInvalidFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := WriteFile(configPath, "hots: 'github.com'\n"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GH_PAT_MF", "")
+	t.Setenv("GH_APP_ID", "")
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	configFlags := RegisterConfigFlags(flags)
+	if err := flags.Parse([]string{"-config", configPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := configFlags.Load(NeedsAuth)
+	for _, problem := range []string{"field hots not found", "no GitHub App (GH_APP_ID) or token (GH_PAT_MF) is configured"} {
+		if err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("Load() returned %v, expected it to contain %q", err, problem)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+const (
+	DriftMissing  = "missing"
+	DriftModified = "modified"
+	DriftExtra    = "extra"
+)
+
+type FileDrift struct {
+	Path      string `json:"path"`
+	Status    string `json:"status"`
+	Ownership string `json:"ownership"`
+}
+
+// RepositoryDrift lists the managed files of a repository that no longer match what the sync
+// would render for it, e.g. because they were edited or deleted directly in the repository, and
+// the extra files that were added where a file set replaces every file.
+type RepositoryDrift struct {
+	Repository string      `json:"repository"`
+	BaseBranch string      `json:"baseBranch"`
+	Version    string      `json:"version"`
+	Files      []FileDrift `json:"files"`
+	Error      string      `json:"error,omitempty"`
+}
+
+func (drift *RepositoryDrift) HasDrift() bool {
+	return len(drift.Files) > 0
+}
+
+// DetectDrift compares the default branch of the target with the rendered files through the
+// API, so nothing has to be cloned. Files that are only created once only drift when they are
+// deleted, and files that a sync would delete are extra.
+func (syncer *Syncer) DetectDrift(target SyncTarget, versionTag string) (*RepositoryDrift, error) {
+	owner, name, err := RepoOwnerName(target.Repository)
+	if err != nil {
+		return nil, err
+	}
+
+	baseBranch, versionTag, err := syncer.resolveSync(target, versionTag)
+	if err != nil {
+		return nil, err
+	}
+
+	managedFiles, err := syncer.RenderFileSets(target, baseBranch, versionTag)
+	if err != nil {
+		return nil, err
+	}
+
+	drift := &RepositoryDrift{
+		Repository: target.Repository,
+		BaseBranch: baseBranch,
+		Version:    versionTag,
+		Files:      []FileDrift{},
+	}
+
+	renderedPaths := map[string]bool{}
+	for _, managedFile := range managedFiles {
+		renderedPaths[managedFile.Path] = true
+
+		contents, found, err := GetRemoteFile(syncer.GitHub, owner, name, managedFile.Path, baseBranch)
+		if err != nil {
+			return nil, err
+		}
+
+		status := ""
+		switch {
+		case !found:
+			status = DriftMissing
+		case managedFile.Ownership == OwnershipReplace && contents != managedFile.Contents:
+			status = DriftModified
+		case managedFile.Ownership == OwnershipBlock:
+			block, found, err := readManagedBlock(contents, managedFile.Markers)
+			if err != nil {
+				status = DriftModified
+			} else if !found {
+				status = DriftMissing
+			} else if block != normalizeBlock(managedFile.Contents) {
+				status = DriftModified
+			}
+		}
+
+		if status != "" {
+			drift.Files = append(drift.Files, FileDrift{Path: managedFile.Path, Status: status, Ownership: managedFile.Ownership})
+		}
+	}
+
+	extraFiles, err := syncer.findExtraFiles(target, owner, name, baseBranch, renderedPaths)
+	if err != nil {
+		return nil, err
+	}
+	for _, extraFile := range extraFiles {
+		drift.Files = append(drift.Files, FileDrift{Path: extraFile, Status: DriftExtra, Ownership: OwnershipReplace})
+	}
+
+	return drift, nil
+}
+
+// findExtraFiles lists the files that match a glob with "replace" ownership but are not rendered,
+// which applyFileSets deletes.
+func (syncer *Syncer) findExtraFiles(target SyncTarget, owner string, name string, baseBranch string, renderedPaths map[string]bool) ([]string, error) {
+	var remoteFiles []TreeFile
+	listedRemoteFiles := false
+	var extraFiles []string
+	for _, fileSet := range target.Files {
+		if fileSet.Ownership != OwnershipReplace || !isGlob(fileSet.Source) {
+			continue
+		}
+
+		if !listedRemoteFiles {
+			var err error
+			if remoteFiles, err = ListRemoteFiles(syncer.GitHub, owner, name, baseBranch); err != nil {
+				return nil, err
+			}
+			listedRemoteFiles = true
+		}
+
+		matches, err := matchTreeFiles(remoteFiles, fileSet.destinationGlob())
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if !renderedPaths[match.Path] && !slices.Contains(extraFiles, match.Path) {
+				extraFiles = append(extraFiles, match.Path)
+			}
+		}
+	}
+
+	return extraFiles, nil
+}
+
+func WriteDriftReport(path string, drifts []RepositoryDrift) error {
+	driftsJson, err := json.MarshalIndent(drifts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not convert drift report to JSON: %w", err)
+	}
+
+	if err := WriteFile(path, string(driftsJson)); err != nil {
+		return fmt.Errorf("could not write drift report to '%s': %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"errors"
+	"strings"
+)
+
+// These can be checked with errors.Is, the errors that are returned wrap them with the details.
+var (
+	ErrInvalidRepository  = errors.New("repository identifier is not in the format \"owner/name\"")
+	ErrBranchNotFound     = errors.New("branch not found")
+	ErrTagNotFound        = errors.New("tag not found")
+	ErrNoChanges          = errors.New("no changes to commit")
+	ErrInvalidConfig      = errors.New("invalid configuration")
+	ErrRepositoriesFailed = errors.New("one or more repositories failed")
+	ErrSyncedFilesEdited  = errors.New("one or more synced files were edited by hand")
+)
+
+// APIError is a response of the GitHub API with an error status, when the client did not return
+// an error of its own.
+type APIError struct {
+	StatusCode int
+	Status     string
+}
+
+func (err *APIError) Error() string {
+	return err.Status
+}
+
+// CommandError is a command that failed, with what it wrote to stderr as its message.
+type CommandError struct {
+	Command string
+	Stderr  string
+	Err     error
+}
+
+func (err *CommandError) Error() string {
+	if err.Stderr != "" {
+		return err.Stderr
+	}
+
+	return err.Err.Error()
+}
+
+func (err *CommandError) Unwrap() error {
+	return err.Err
+}
+
+// gitFailures recognize failures of git by what it wrote to stderr, so that they can be checked
+// with errors.Is.
+var gitFailures = []struct {
+	messages []string
+	err      error
+}{
+	{[]string{"not found in upstream", "did not match any file(s) known to git", "invalid reference:"}, ErrBranchNotFound},
+	{[]string{"nothing to commit", "nothing added to commit"}, ErrNoChanges},
+}
+
+func classifyGitFailure(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, failure := range gitFailures {
+		for _, failureMessage := range failure.messages {
+			if strings.Contains(message, failureMessage) {
+				return &wrappedError{sentinel: failure.err, err: err}
+			}
+		}
+	}
+
+	return err
+}
+
+// isUnknownRevision is true when git did not know a ref, e.g. a tag that was deleted.
+func isUnknownRevision(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "unknown revision") || strings.Contains(message, "bad revision") || strings.Contains(message, "invalid object name") || strings.Contains(message, "not a valid object name")
+}
+
+// wrappedError keeps the message of err, but is also sentinel for errors.Is.
+type wrappedError struct {
+	sentinel error
+	err      error
+}
+
+func (err *wrappedError) Error() string {
+	return err.err.Error()
+}
+
+func (err *wrappedError) Unwrap() []error {
+	return []error{err.sentinel, err.err}
+}
@@ -0,0 +1,76 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+
+	gogithub "github.com/google/go-github/v62/github"
+)
+
+// The exit codes of the commands, so that workflows can tell failures apart.
+const (
+	ExitSuccess = 0
+	// ExitFailure is any failure that has no exit code of its own.
+	ExitFailure            = 1
+	ExitInvalidConfig      = 2
+	ExitRepositoriesFailed = 3
+	ExitSyncedFilesEdited  = 4
+	ExitGitHubAPIFailed    = 5
+	ExitGitFailed          = 6
+)
+
+func ExitCode(err error) int {
+	var apiError *APIError
+	var errorResponse *gogithub.ErrorResponse
+	var commandError *CommandError
+
+	switch {
+	case err == nil:
+		return ExitSuccess
+	case errors.Is(err, ErrInvalidConfig):
+		return ExitInvalidConfig
+	case errors.Is(err, ErrRepositoriesFailed):
+		return ExitRepositoriesFailed
+	case errors.Is(err, ErrSyncedFilesEdited):
+		return ExitSyncedFilesEdited
+	case errors.As(err, &apiError) || errors.As(err, &errorResponse):
+		return ExitGitHubAPIFailed
+	case errors.As(err, &commandError):
+		return ExitGitFailed
+	}
+
+	return ExitFailure
+}
+
+var summaryNewlinePattern = regexp.MustCompile(`\r\n|[\r\n\v\f\x{0085}\x{2028}\x{2029}]`)
+
+// Exit ends a command with the exit code of err, after flushing its redacted output. When it
+// failed, the error is logged and added to the job summary. Without a config, e.g. when it could
+// not be loaded, the job summary of GitHub Actions is used directly.
+func Exit(config *Config, command string, err error) {
+	if err == nil {
+		flushRedaction()
+		os.Exit(ExitSuccess)
+	}
+
+	exitCode := ExitCode(err)
+	log.Printf("%s failed (exit code %v): %v\n", command, exitCode, err)
+
+	summaryPath := os.Getenv("GITHUB_STEP_SUMMARY")
+	if config != nil {
+		summaryPath = config.SummaryPath
+	}
+
+	if summaryPath != "" {
+		summary := fmt.Sprintf("\r\n### ❌ `%s` Failed\r\n*%s (exit code `%v`).*\r\n", command, summaryNewlinePattern.ReplaceAllString(err.Error(), "; "), exitCode)
+		if err := AppendFile(summaryPath, Secrets.Redact(summary)); err != nil {
+			log.Printf("Could not write the failure to the job summary: %v\n", err)
+		}
+	}
+
+	flushRedaction()
+	os.Exit(exitCode)
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	gogithub "github.com/google/go-github/v62/github"
+)
+
+func TestExitCode(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), ManifestPath)
+	if err := WriteFile(manifestPath, "version: 1\nrepositories: []\n"); err != nil {
+		t.Fatal(err)
+	}
+	_, manifestErr := LoadManifest(manifestPath)
+
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"success", nil, ExitSuccess},
+		{"other", errors.New("something failed"), ExitFailure},
+		{"invalid config", fmt.Errorf("%w: host is empty", ErrInvalidConfig), ExitInvalidConfig},
+		{"invalid manifest", manifestErr, ExitInvalidConfig},
+		{"repositories failed", fmt.Errorf("1/3 repositories: %w", ErrRepositoriesFailed), ExitRepositoriesFailed},
+		{"synced files edited", fmt.Errorf("1/2 files: %w", ErrSyncedFilesEdited), ExitSyncedFilesEdited},
+		{"GitHub API", fmt.Errorf("could not merge: %w", &APIError{StatusCode: 405, Status: "405 Method Not Allowed"}), ExitGitHubAPIFailed},
+		{"GitHub API response", fmt.Errorf("could not merge: %w", &gogithub.ErrorResponse{Message: "Not Found"}), ExitGitHubAPIFailed},
+		{"git", fmt.Errorf("could not push: %w", &CommandError{}), ExitGitFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if exitCode := ExitCode(test.err); exitCode != test.expected {
+				t.Errorf("ExitCode() = %v, expected %v", exitCode, test.expected)
+			}
+		})
+	}
+}
+
+// TestExitFlushesRedactedOutput runs Exit in a subprocess, since it exits the process.
+func TestExitFlushesRedactedOutput(t *testing.T) {
+	if command := os.Getenv("TEST_EXIT_COMMAND"); command != "" {
+		if err := SetupRedaction(); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Println("token: ghp_exit-secret-from-env")
+		fmt.Print("done")
+
+		var err error
+		if command == "failure" {
+			err = fmt.Errorf("%w: host is empty", ErrInvalidConfig)
+		}
+		Exit(&Config{}, command, err)
+	}
+
+	tests := []struct {
+		command  string
+		exitCode int
+	}{
+		{"success", ExitSuccess},
+		{"failure", ExitInvalidConfig},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestExitFlushesRedactedOutput$")
+			cmd.Env = append(os.Environ(), "TEST_EXIT_COMMAND="+test.command, "GH_PAT_MF=ghp_exit-secret-from-env", "GITHUB_ACTIONS=")
+			output, err := cmd.Output()
+
+			exitCode := 0
+			var exitError *exec.ExitError
+			if errors.As(err, &exitError) {
+				exitCode = exitError.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if exitCode != test.exitCode {
+				t.Errorf("Exit() exited with %v, expected %v", exitCode, test.exitCode)
+			}
+			if string(output) != "token: <redacted>\ndone" {
+				t.Errorf("Exit() flushed %q to stdout, expected the redacted output", output)
+			}
+		})
+	}
+}
@@ -2,10 +2,8 @@ package common
 
 import (
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"path/filepath"
 )
 
 func PathExists(path string) bool {
@@ -30,6 +28,21 @@ func WriteFile(filePath string, contents string) error {
 	return nil
 }
 
+func AppendFile(filePath string, contents string) error {
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	if _, err = file.WriteString(contents); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func ReadFile(filePath string) (string, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
@@ -55,81 +68,35 @@ func DeleteDirectory(dir string) error {
 	return nil
 }
 
-func CopyFile(sourcePath string, targetPath string) error {
-	sourceFile, err := os.Open(sourcePath)
+func ModifyFile(path string, modifyContents func(string) (string, error)) error {
+	contents, err := ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("could not open source file '%s': %w", sourcePath, err)
+		return fmt.Errorf("could not read from file: %w", err)
 	}
-	defer sourceFile.Close()
 
-	targetFile, err := os.Create(targetPath)
+	modifiedContents, err := modifyContents(contents)
 	if err != nil {
-		return fmt.Errorf("could not create target file '%s': %w", targetPath, err)
+		return err
 	}
-	defer targetFile.Close()
 
-	_, err = io.Copy(targetFile, sourceFile)
-	if err != nil {
-		return fmt.Errorf("could not copy data from '%s' to '%s': %w", sourcePath, targetPath, err)
+	if err := WriteFile(path, modifiedContents); err != nil {
+		return fmt.Errorf("could not write to file: %w", err)
 	}
 
 	return nil
 }
 
-func ForSpecificFiles(dir string, isSpecific func(os.FileInfo) bool, doSomething func(string, os.FileInfo) error) error {
-	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !info.IsDir() && isSpecific(info) {
-			if err := doSomething(path, info); err != nil {
-				return fmt.Errorf("could not do something with a specific file '%s': %v", path, err)
-			}
-		}
-
-		return nil
-	})
-}
-
-func DeleteSpecificFiles(dir string, shouldDelete func(os.FileInfo) bool) error {
-	return ForSpecificFiles(dir, shouldDelete, func(path string, info os.FileInfo) error {
-		if err := os.Remove(path); err != nil {
-			return fmt.Errorf("could not delete file: %v", err)
-		}
-
-		return nil
-	})
-}
-
-func CopySpecificFiles(sourceDir string, targetDir string, shouldCopy func(os.FileInfo) bool) error {
-	return ForSpecificFiles(sourceDir, shouldCopy, func(path string, info os.FileInfo) error {
-		if err := CopyFile(path, filepath.Join(targetDir, info.Name())); err != nil {
-			return fmt.Errorf("could not copy file to '%s': %v", targetDir, err)
-		}
-
-		return nil
-	})
-}
-
-func ModifySpecificFiles(dir string, shouldModify func(os.FileInfo) bool, modifyContents func(string) string) error {
-	return ForSpecificFiles(dir, shouldModify, func(path string, info os.FileInfo) error {
-		contents, err := ReadFile(path)
-		if err != nil {
-			return fmt.Errorf("could not read from file: %v", err)
-		}
-
-		if err := WriteFile(path, modifyContents(contents)); err != nil {
-			return fmt.Errorf("could not write to file: %v", err)
-		}
-
+// WriteOutput writes to the log when there is no output file, e.g. outside of GitHub Actions.
+func WriteOutput(config *Config, output string) error {
+	keyValuePair := fmt.Sprintf("go-output=%s", output)
+	if config.OutputPath == "" {
+		log.Printf("Output: %s\n", keyValuePair)
 		return nil
-	})
-}
+	}
 
-func WriteOutput(output string) {
-	keyValuePair := fmt.Sprintf("go-output=%s", output)
-	if err := WriteFile(GetEnv("GITHUB_OUTPUT"), keyValuePair); err != nil {
-		log.Fatalf("could not write '%s' to GITHUB_OUTPUT: %v", keyValuePair, err)
+	if err := WriteFile(config.OutputPath, keyValuePair); err != nil {
+		return fmt.Errorf("could not write '%s' to '%s': %w", keyValuePair, config.OutputPath, err)
 	}
+
+	return nil
 }
@@ -0,0 +1,379 @@
+package common
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	OwnershipReplace = "replace"
+	OwnershipCreate  = "create"
+	OwnershipBlock   = "block"
+)
+
+var Ownerships = []string{OwnershipReplace, OwnershipCreate, OwnershipBlock}
+
+// ManagedFile is a rendered file of a file set. With "block" ownership, Contents is only the
+// managed block inside the file, between the Markers.
+type ManagedFile struct {
+	Path      string
+	Contents  string
+	Mode      fs.FileMode
+	Ownership string
+	Markers   BlockMarkers
+}
+
+const globCharacters = "*?[{"
+
+// globToRegexp supports "*" and "?" within a path segment, "**" across segments, character
+// classes like "[abc]" and alternatives like "{yaml,yml}".
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+
+	alternatives := 0
+	for index := 0; index < len(glob); index++ {
+		character := glob[index]
+		switch {
+		case strings.HasPrefix(glob[index:], "**/"):
+			pattern.WriteString("(?:.*/)?")
+			index += 2
+		case strings.HasPrefix(glob[index:], "**"):
+			pattern.WriteString(".*")
+			index += 1
+		case character == '*':
+			pattern.WriteString("[^/]*")
+		case character == '?':
+			pattern.WriteString("[^/]")
+		case character == '[':
+			closingIndex := strings.IndexByte(glob[index+1:], ']')
+			if closingIndex < 0 {
+				return nil, fmt.Errorf("unclosed '[' in '%s'", glob)
+			}
+			class := glob[index+1 : index+1+closingIndex]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			pattern.WriteString("[" + class + "]")
+			index += closingIndex + 1
+		case character == '{':
+			pattern.WriteString("(?:")
+			alternatives += 1
+		case character == ',' && alternatives > 0:
+			pattern.WriteString("|")
+		case character == '}' && alternatives > 0:
+			pattern.WriteString(")")
+			alternatives -= 1
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(character)))
+		}
+	}
+	if alternatives > 0 {
+		return nil, fmt.Errorf("unclosed '{' in '%s'", glob)
+	}
+
+	pattern.WriteString("$")
+	return regexp.Compile(pattern.String())
+}
+
+func isGlob(sourcePath string) bool {
+	return strings.ContainsAny(sourcePath, globCharacters)
+}
+
+// globBase is the directory that the matches of a glob are relative to, i.e. everything up to
+// the first segment with a wildcard.
+func globBase(glob string) string {
+	var baseSegments []string
+	for _, segment := range strings.Split(glob, "/") {
+		if isGlob(segment) {
+			break
+		}
+		baseSegments = append(baseSegments, segment)
+	}
+
+	return strings.Join(baseSegments, "/")
+}
+
+// DestinationPath is where a source file ends up in the target repository. For globs, the
+// destination is a directory and the structure below the base of the glob is preserved, for a
+// single file the destination is the path of the file itself.
+func (fileSet FileSet) DestinationPath(relativePath string) string {
+	destination := fileSet.Destination
+	if !isGlob(fileSet.Source) {
+		if destination == "" {
+			destination = fileSet.Source
+		}
+		return path.Clean(destination)
+	}
+
+	if destination == "" {
+		destination = globBase(fileSet.Source)
+	}
+
+	return path.Join(destination, relativePath)
+}
+
+// destinationGlob matches the files in the target repository that the file set manages.
+func (fileSet FileSet) destinationGlob() string {
+	if !isGlob(fileSet.Source) {
+		return fileSet.DestinationPath("")
+	}
+
+	base := globBase(fileSet.Source)
+	relativeGlob := strings.TrimPrefix(strings.TrimPrefix(fileSet.Source, base), "/")
+	return fileSet.DestinationPath(relativeGlob)
+}
+
+func (fileSet FileSet) MatchesSource(filePath string) bool {
+	if !isGlob(fileSet.Source) {
+		return path.Clean(filePath) == path.Clean(fileSet.Source)
+	}
+
+	sourcePattern, err := globToRegexp(fileSet.Source)
+	return err == nil && sourcePattern.MatchString(filePath)
+}
+
+// matchFiles lists the files below dir that match glob, relative to the base of glob.
+func matchFiles(dir string, glob string) ([]string, error) {
+	if !isGlob(glob) {
+		if info, err := os.Stat(filepath.Join(dir, glob)); err != nil || info.IsDir() {
+			return nil, nil
+		}
+		return []string{""}, nil
+	}
+
+	globPattern, err := globToRegexp(glob)
+	if err != nil {
+		return nil, err
+	}
+
+	base := globBase(glob)
+	baseDir := filepath.Join(dir, base)
+	if !PathExists(baseDir) {
+		return nil, nil
+	}
+
+	var matches []string
+	err = filepath.WalkDir(baseDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relativeToBase, err := filepath.Rel(baseDir, filePath)
+		if err != nil {
+			return err
+		}
+		relativeToBase = filepath.ToSlash(relativeToBase)
+
+		if globPattern.MatchString(path.Join(base, relativeToBase)) {
+			matches = append(matches, relativeToBase)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not match '%s': %w", glob, err)
+	}
+
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// matchTreeFiles lists the files of a tree that match glob, or the file itself if it is a path.
+func matchTreeFiles(files []TreeFile, glob string) ([]TreeFile, error) {
+	if !isGlob(glob) {
+		for _, file := range files {
+			if file.Path == path.Clean(glob) {
+				return []TreeFile{file}, nil
+			}
+		}
+		return nil, nil
+	}
+
+	globPattern, err := globToRegexp(glob)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []TreeFile
+	for _, file := range files {
+		if globPattern.MatchString(file.Path) {
+			matches = append(matches, file)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Path < matches[j].Path })
+	return matches, nil
+}
+
+// RenderFileSets renders every file of the target's file sets in memory, so that the result
+// can be written to a clone, but also compared with what a repository currently contains. The
+// files are those of the source repository at versionTag, not those of its checkout.
+func (syncer *Syncer) RenderFileSets(target SyncTarget, baseBranch string, versionTag string) ([]ManagedFile, error) {
+	templateData, err := NewTemplateData(target, baseBranch, versionTag)
+	if err != nil {
+		return nil, err
+	}
+	sourceName := syncer.Source[strings.LastIndex(syncer.Source, "/")+1:]
+
+	sourceFiles, err := syncer.listSourceFiles(versionTag)
+	if err != nil {
+		return nil, err
+	}
+
+	var managedFiles []ManagedFile
+	for _, fileSet := range target.Files {
+		matches, err := matchTreeFiles(sourceFiles, fileSet.Source)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 && !isGlob(fileSet.Source) {
+			return nil, fmt.Errorf("could not find source file '%s' at '%s'", fileSet.Source, versionTag)
+		}
+
+		base := fileSet.Source
+		if isGlob(base) {
+			base = globBase(base)
+		}
+
+		for _, match := range matches {
+			sourcePath := match.Path
+			relativePath := strings.TrimPrefix(strings.TrimPrefix(sourcePath, base), "/")
+			destinationPath := fileSet.DestinationPath(relativePath)
+
+			contents, err := syncer.readSourceFile(versionTag, sourcePath)
+			if err != nil {
+				return nil, err
+			}
+
+			if contents, err = RenderTemplate(sourcePath, contents, templateData); err != nil {
+				return nil, fmt.Errorf("could not render '%s': %w", sourcePath, err)
+			}
+
+			if extension := path.Ext(destinationPath); extension == ".yaml" || extension == ".yml" {
+				if contents, err = RewriteWorkflowRefs(contents, syncer.Source, versionTag); err != nil {
+					return nil, fmt.Errorf("could not replace refs in '%s': %w", sourcePath, err)
+				}
+			}
+
+			managedFile := ManagedFile{
+				Path:      destinationPath,
+				Contents:  contents,
+				Mode:      match.Mode,
+				Ownership: fileSet.Ownership,
+			}
+			if fileSet.Ownership == OwnershipBlock {
+				managedFile.Markers = NewBlockMarkers(fileSet.Comment, sourceName)
+			}
+			managedFiles = append(managedFiles, managedFile)
+		}
+	}
+
+	return managedFiles, nil
+}
+
+// applyFileSets writes the rendered files to the clone of the target. Files owned by a file
+// set that are no longer synced are deleted, files that are only created once are left alone
+// if they exist, and managed blocks are replaced inside the existing files. The lockfile is only
+// rewritten when what the target receives changes. It returns every path it changed, so exactly
+// those can be staged.
+func (syncer *Syncer) applyFileSets(repo *Repo, target SyncTarget, baseBranch string, versionTag string) ([]string, error) {
+	managedFiles, err := syncer.RenderFileSets(target, baseBranch, versionTag)
+	if err != nil {
+		return nil, err
+	}
+
+	renderedPaths := map[string]bool{}
+	for _, managedFile := range managedFiles {
+		renderedPaths[managedFile.Path] = true
+	}
+
+	var changedPaths []string
+	for _, fileSet := range target.Files {
+		if fileSet.Ownership != OwnershipReplace {
+			continue
+		}
+
+		destinationGlob := fileSet.destinationGlob()
+		existingFiles, err := matchFiles(repo.Dir, destinationGlob)
+		if err != nil {
+			return nil, err
+		}
+
+		destinationBase := destinationGlob
+		if isGlob(destinationBase) {
+			destinationBase = globBase(destinationBase)
+		}
+
+		for _, relativePath := range existingFiles {
+			existingPath := path.Join(destinationBase, relativePath)
+			if renderedPaths[existingPath] {
+				continue
+			}
+
+			if err := os.Remove(filepath.Join(repo.Dir, existingPath)); err != nil {
+				return nil, fmt.Errorf("could not delete '%s' from target repo '%s': %w", existingPath, target.Repository, err)
+			}
+			changedPaths = append(changedPaths, existingPath)
+		}
+	}
+
+	for _, managedFile := range managedFiles {
+		targetPath := filepath.Join(repo.Dir, managedFile.Path)
+		if managedFile.Ownership == OwnershipCreate && PathExists(targetPath) {
+			continue
+		}
+
+		if managedFile.Ownership == OwnershipBlock && PathExists(targetPath) {
+			err := ModifyFile(targetPath, func(contents string) (string, error) {
+				return ReplaceManagedBlock(contents, managedFile.Contents, managedFile.Markers)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("could not update managed block of '%s' in target repo '%s': %w", managedFile.Path, target.Repository, err)
+			}
+			changedPaths = append(changedPaths, managedFile.Path)
+			continue
+		} else if managedFile.Ownership == OwnershipBlock {
+			contents, _ := ReplaceManagedBlock("", managedFile.Contents, managedFile.Markers)
+			managedFile.Contents = contents
+		}
+
+		if err := CreateDirectory(filepath.Dir(targetPath)); err != nil {
+			return nil, fmt.Errorf("could not create directory for '%s' in target repo '%s': %w", managedFile.Path, target.Repository, err)
+		}
+		if err := os.WriteFile(targetPath, []byte(managedFile.Contents), managedFile.Mode); err != nil {
+			return nil, fmt.Errorf("could not write '%s' to target repo '%s': %w", managedFile.Path, target.Repository, err)
+		}
+		if err := os.Chmod(targetPath, managedFile.Mode); err != nil {
+			return nil, fmt.Errorf("could not set mode of '%s' in target repo '%s': %w", managedFile.Path, target.Repository, err)
+		}
+		changedPaths = append(changedPaths, managedFile.Path)
+	}
+
+	lock := NewSyncLock(syncer.Source, syncer.releaseTag(versionTag), syncer.SourceCommits[versionTag], managedFiles)
+	lockPath := filepath.Join(repo.Dir, LockPath)
+	if existingLock, err := LoadSyncLock(lockPath); err == nil && existingLock.IsEquivalent(lock) {
+		return changedPaths, nil
+	}
+
+	if err := CreateDirectory(filepath.Dir(lockPath)); err != nil {
+		return nil, fmt.Errorf("could not create directory for '%s' in target repo '%s': %w", LockPath, target.Repository, err)
+	}
+	if err := WriteSyncLock(lockPath, lock); err != nil {
+		return nil, fmt.Errorf("could not write lockfile to target repo '%s': %w", target.Repository, err)
+	}
+	changedPaths = append(changedPaths, LockPath)
+
+	return changedPaths, nil
+}
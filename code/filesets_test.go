@@ -0,0 +1,53 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderFileSetsReadsSourceAtVersion(t *testing.T) {
+	backend := NewMemoryGit()
+	backend.AddRemote("common.git", "main", map[string]string{
+		".github/workflows/synced_build.yaml": "uses: 'org/common/.github/workflows/build.yaml@main'\n",
+		"README.md":                           "released\n",
+	})
+
+	sourceDir := t.TempDir()
+	if err := backend.Clone("common.git", sourceDir, "main"); err != nil {
+		t.Fatalf("Clone() returned an error: %v", err)
+	}
+	if err := backend.Tag(sourceDir, "v1", "", false); err != nil {
+		t.Fatalf("Tag() returned an error: %v", err)
+	}
+
+	unreleasedPath := filepath.Join(sourceDir, ".github", "workflows", "synced_build.yaml")
+	if err := os.WriteFile(unreleasedPath, []byte("unreleased: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Add(sourceDir, []string{"."}); err != nil {
+		t.Fatalf("Add() returned an error: %v", err)
+	}
+	if err := backend.Commit(sourceDir, "feat: unreleased"); err != nil {
+		t.Fatalf("Commit() returned an error: %v", err)
+	}
+
+	syncer := &Syncer{Git: backend, Source: "org/common", SourceDir: sourceDir}
+	target := SyncTarget{Repository: "org/component", Files: DefaultFileSets}
+
+	managedFiles, err := syncer.RenderFileSets(target, "main", "v1")
+	if err != nil {
+		t.Fatalf("RenderFileSets() returned an error: %v", err)
+	}
+
+	if len(managedFiles) != 1 {
+		t.Fatalf("RenderFileSets() returned %v files, expected 1", len(managedFiles))
+	}
+	if expected := "uses: 'org/common/.github/workflows/build.yaml@v1'\n"; managedFiles[0].Contents != expected {
+		t.Errorf("RenderFileSets() rendered %q, expected the file at 'v1': %q", managedFiles[0].Contents, expected)
+	}
+
+	if _, err := syncer.RenderFileSets(target, "main", "v2"); err == nil {
+		t.Errorf("RenderFileSets() did not return an error for a tag that does not exist")
+	}
+}
@@ -0,0 +1,786 @@
+package common
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"strings"
+)
+
+type GitBackend interface {
+	Clone(url string, dir string, branch string) error
+	GetConfig(dir string, key string) (string, error)
+	SetConfig(dir string, key string, value string) error
+	SetRemoteURL(dir string, remote string, url string) error
+	Status(dir string) ([]string, error)
+	LocalBranches(dir string) ([]string, error)
+	Checkout(dir string, branch string, create bool) error
+	DeleteLocalBranch(dir string, branch string) error
+	Add(dir string, paths []string) error
+	Commit(dir string, message string) error
+	Push(dir string, remote string, refspecs []string, force bool) error
+	ListRemoteRefs(dir string, remote string) ([]RemoteRef, error)
+	Tag(dir string, tag string, message string, force bool) error
+	DeleteTag(dir string, tag string) error
+	TagMessage(dir string, tag string) (string, error)
+	ChangedFiles(dir string, since string, paths []string) ([]FileChange, error)
+	Log(dir string, since string, paths []string) ([]string, error)
+	ShowFile(dir string, ref string, path string) (string, error)
+	ListFiles(dir string, ref string) ([]TreeFile, error)
+	StagedChanges(dir string) ([]FileChange, error)
+	StagedDiff(dir string) (string, error)
+}
+
+type RemoteRef struct {
+	Name string
+	Hash string
+}
+
+func (ref RemoteRef) IsTag() bool {
+	return strings.HasPrefix(ref.Name, "refs/tags/")
+}
+
+func (ref RemoteRef) IsBranch() bool {
+	return strings.HasPrefix(ref.Name, "refs/heads/")
+}
+
+func (ref RemoteRef) ShortName() string {
+	return strings.TrimPrefix(strings.TrimPrefix(ref.Name, "refs/tags/"), "refs/heads/")
+}
+
+// TreeFile is a file in the tree of a commit.
+type TreeFile struct {
+	Path string
+	Mode fs.FileMode
+}
+
+type Repo struct {
+	Dir       string
+	Backend   GitBackend
+	RemoteURL func(repo string) string
+}
+
+func OpenRepo(config *Config, dir string) *Repo {
+	return &Repo{Dir: dir, Backend: config.GitBackend(), RemoteURL: config.RemoteURL}
+}
+
+func CloneRepository(config *Config, repo string, dir string, branch string) (*Repo, error) {
+	clonedRepo := OpenRepo(config, dir)
+	if err := clonedRepo.Clone(repo, branch); err != nil {
+		return nil, err
+	}
+
+	return clonedRepo, nil
+}
+
+func (repo *Repo) Clone(remoteRepo string, branch string) error {
+	if PathExists(repo.Dir) {
+		DeleteDirectory(repo.Dir)
+	}
+
+	if err := repo.Backend.Clone(repo.RemoteURL(remoteRepo), repo.Dir, branch); err != nil {
+		return fmt.Errorf("could not clone git repository '%s' to '%s': %w", remoteRepo, repo.Dir, err)
+	}
+
+	if err := repo.SetOrigin(remoteRepo); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *Repo) SetupGitHubUser(user GitUser) error {
+	if err := repo.Backend.SetConfig(repo.Dir, "user.name", user.Name); err != nil {
+		return fmt.Errorf("could not set up git user: %w", err)
+	}
+
+	if err := repo.Backend.SetConfig(repo.Dir, "user.email", user.Email); err != nil {
+		return fmt.Errorf("could not set up git user: %w", err)
+	}
+
+	return nil
+}
+
+func (repo *Repo) SetOrigin(remoteRepo string) error {
+	if err := repo.Backend.SetRemoteURL(repo.Dir, "origin", repo.RemoteURL(remoteRepo)); err != nil {
+		return fmt.Errorf("could not set url to git repository '%s': %w", remoteRepo, err)
+	}
+
+	return nil
+}
+
+func (repo *Repo) GetCurrentRepository() (string, error) {
+	repoUrl, err := repo.Backend.GetConfig(repo.Dir, "remote.origin.url")
+	if err != nil {
+		return "", fmt.Errorf("could not get current repository: %w", err)
+	}
+	if repoUrl == "" {
+		return "", fmt.Errorf("could not get current repository, it returned \"\"")
+	}
+
+	return ParseRepositoryURL(repoUrl)
+}
+
+func (repo *Repo) GetFilesChangedSince(tag string, path string) ([]string, error) {
+	changes, err := repo.GetChangesSince(tag, path)
+	if err != nil {
+		return nil, err
+	}
+
+	filesChanged := []string{}
+	for _, change := range changes {
+		filesChanged = append(filesChanged, change.Path)
+	}
+
+	return filesChanged, nil
+}
+
+// GetChangesSince lists the files that changed between tag and HEAD, i.e. changes in the working
+// tree are left out.
+func (repo *Repo) GetChangesSince(tag string, paths ...string) ([]FileChange, error) {
+	changes, err := repo.Backend.ChangedFiles(repo.Dir, tag, paths)
+	if err != nil && isUnknownRevision(err) {
+		return nil, fmt.Errorf("could not get files changed since '%s': %w: %w", tag, ErrTagNotFound, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("could not get files changed since '%s': %w", tag, err)
+	}
+
+	return changes, nil
+}
+
+func (repo *Repo) GetCommitMessagesSince(tag string, paths ...string) ([]string, error) {
+	messages, err := repo.Backend.Log(repo.Dir, tag, paths)
+	if err != nil && isUnknownRevision(err) {
+		return nil, fmt.Errorf("could not get commit messages since '%s': %w: %w", tag, ErrTagNotFound, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("could not get commit messages since '%s': %w", tag, err)
+	}
+
+	return messages, nil
+}
+
+func (repo *Repo) GetFileAt(ref string, path string) (string, error) {
+	contents, err := repo.Backend.ShowFile(repo.Dir, ref, path)
+	if err != nil {
+		return "", fmt.Errorf("could not read '%s' at '%s': %w", path, ref, err)
+	}
+
+	return contents, nil
+}
+
+func (repo *Repo) GetFilesChangedInLastCommit(path string) ([]string, error) {
+	return repo.GetFilesChangedSince("HEAD^", path)
+}
+
+func (repo *Repo) IsWorkingTreeClean() (bool, error) {
+	changes, err := repo.Backend.Status(repo.Dir)
+	if err != nil {
+		return false, fmt.Errorf("could not check if working tree was clean: %w", err)
+	}
+
+	return len(changes) == 0, nil
+}
+
+func (repo *Repo) LocalBranchExists(branch string) (bool, error) {
+	branches, err := repo.Backend.LocalBranches(repo.Dir)
+	if err != nil {
+		return false, fmt.Errorf("could not check if branch '%s' exists locally: %w", branch, err)
+	}
+
+	for _, localBranch := range branches {
+		if localBranch == branch {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (repo *Repo) DeleteLocalBranch(branch string) error {
+	if err := repo.Backend.DeleteLocalBranch(repo.Dir, branch); err != nil {
+		return fmt.Errorf("could not delete local branch '%s': %w", branch, err)
+	}
+
+	return nil
+}
+
+func (repo *Repo) DeleteRemoteBranch(branch string) error {
+	if err := repo.Backend.Push(repo.Dir, "origin", []string{":refs/heads/" + branch}, false); err != nil {
+		return fmt.Errorf("could not delete remote branch '%s': %w", branch, err)
+	}
+
+	return nil
+}
+
+func (repo *Repo) CheckoutNewBranch(branch string) error {
+	if err := repo.Backend.Checkout(repo.Dir, branch, true); err != nil {
+		return fmt.Errorf("could not checkout new branch '%s': %w", branch, err)
+	}
+
+	return nil
+}
+
+func (repo *Repo) CheckoutExistingBranch(branch string) error {
+	if err := repo.Backend.Checkout(repo.Dir, branch, false); err != nil {
+		return fmt.Errorf("could not checkout existing branch '%s': %w", branch, err)
+	}
+
+	return nil
+}
+
+func (repo *Repo) Add(paths []string) error {
+	if err := repo.Backend.Add(repo.Dir, paths); err != nil {
+		return fmt.Errorf("could not add '%s': %w", strings.Join(paths, "', '"), err)
+	}
+
+	return nil
+}
+
+func (repo *Repo) StagedChanges() ([]FileChange, error) {
+	changes, err := repo.Backend.StagedChanges(repo.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not get staged changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+func (repo *Repo) StagedDiff() (string, error) {
+	diff, err := repo.Backend.StagedDiff(repo.Dir)
+	if err != nil {
+		return "", fmt.Errorf("could not get staged diff: %w", err)
+	}
+
+	return diff, nil
+}
+
+func (repo *Repo) RemoteBranchExists(branch string) (bool, error) {
+	refs, err := repo.Backend.ListRemoteRefs(repo.Dir, "origin")
+	if err != nil {
+		return false, fmt.Errorf("could not check if branch '%s' exists remotely: %w", branch, err)
+	}
+
+	for _, ref := range refs {
+		if ref.IsBranch() && ref.ShortName() == branch {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (repo *Repo) DeleteBranch(branch string, baseBranch string) error {
+	if err := repo.CheckoutExistingBranch(baseBranch); err != nil {
+		return err
+	}
+
+	if exists, err := repo.LocalBranchExists(branch); err != nil {
+		return err
+	} else if exists {
+		if err := repo.DeleteLocalBranch(branch); err != nil {
+			return err
+		}
+	}
+
+	if exists, err := repo.RemoteBranchExists(branch); err != nil {
+		return err
+	} else if exists {
+		if err := repo.DeleteRemoteBranch(branch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repo *Repo) CreateAndPushToNewBranch(branch string, baseBranch string, paths []string) error {
+	if err := repo.DeleteBranch(branch, baseBranch); err != nil {
+		return fmt.Errorf("could not delete old '%s' branch: %w", branch, err)
+	}
+
+	if err := repo.CheckoutNewBranch(branch); err != nil {
+		return err
+	}
+
+	return repo.CommitAndPush(branch, paths)
+}
+
+// CommitAndPush returns ErrNoChanges when there was nothing to commit.
+func (repo *Repo) CommitAndPush(branch string, paths []string) error {
+	if err := repo.Add(paths); err != nil {
+		return err
+	}
+
+	if clean, err := repo.IsWorkingTreeClean(); err != nil {
+		return err
+	} else if clean {
+		log.Println("No changes to commit, we are up to date!")
+		return ErrNoChanges
+	}
+
+	if err := repo.Backend.Commit(repo.Dir, "sync workflows"); err != nil {
+		return fmt.Errorf("could not commit changes: %w", err)
+	}
+
+	if err := repo.Backend.Push(repo.Dir, "origin", []string{"refs/heads/" + branch}, false); err != nil {
+		return fmt.Errorf("could not push to remote '%s': %w", branch, err)
+	}
+
+	return nil
+}
+
+func (repo *Repo) RemoteTags() ([]RemoteRef, error) {
+	refs, err := repo.Backend.ListRemoteRefs(repo.Dir, "origin")
+	if err != nil {
+		return nil, fmt.Errorf("could not list remote tags: %w", err)
+	}
+
+	var tags []RemoteRef
+	for _, ref := range refs {
+		if ref.IsTag() {
+			tags = append(tags, ref)
+		}
+	}
+
+	return tags, nil
+}
+
+func (repo *Repo) AddTag(tag string) error {
+	if err := repo.Backend.Tag(repo.Dir, tag, "", false); err != nil {
+		return fmt.Errorf("could not update local tag '%s': %w", tag, err)
+	}
+
+	if err := repo.Backend.Push(repo.Dir, "origin", []string{"refs/tags/" + tag}, false); err != nil {
+		return fmt.Errorf("could not push remote tag '%s': %w", tag, err)
+	}
+
+	return nil
+}
+
+func (repo *Repo) MoveTag(tag string) error {
+	// See recommendation from https://github.com/actions/toolkit/blob/master/docs/action-versioning.md
+	if err := repo.Backend.Tag(repo.Dir, tag, fmt.Sprintf("Update tag `%s` to latest commit", tag), true); err != nil {
+		return fmt.Errorf("could not update local tag '%s': %w", tag, err)
+	}
+
+	if err := repo.Backend.Push(repo.Dir, "origin", []string{"refs/tags/" + tag}, true); err != nil {
+		return fmt.Errorf("could not push remote tag '%s': %w", tag, err)
+	}
+
+	return nil
+}
+
+func (repo *Repo) TagExists(tag string) (bool, error) {
+	tags, err := repo.RemoteTags()
+	if err != nil {
+		return false, fmt.Errorf("could not check whether tag '%s' exists: %w", tag, err)
+	}
+
+	for _, remoteTag := range tags {
+		if remoteTag.ShortName() == tag {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// GetTagCommits maps every remote tag to the commit it points to.
+func (repo *Repo) GetTagCommits() (map[string]string, error) {
+	tags, err := repo.RemoteTags()
+	if err != nil {
+		return nil, err
+	}
+
+	tagCommits := map[string]string{}
+	for _, tag := range tags {
+		tagCommits[tag.ShortName()] = tag.Hash
+	}
+
+	return tagCommits, nil
+}
+
+func (repo *Repo) GetTagMessage(tag string) (string, error) {
+	message, err := repo.Backend.TagMessage(repo.Dir, tag)
+	if err != nil {
+		return "", fmt.Errorf("could not get message of tag '%s': %w", tag, err)
+	}
+
+	return message, nil
+}
+
+func (repo *Repo) DeleteTag(tag string) error {
+	if err := repo.Backend.DeleteTag(repo.Dir, tag); err != nil {
+		return fmt.Errorf("could not delete local tag '%s': %w", tag, err)
+	}
+
+	if err := repo.Backend.Push(repo.Dir, "origin", []string{":refs/tags/" + tag}, false); err != nil {
+		return fmt.Errorf("could not delete remote tag '%s': %w", tag, err)
+	}
+
+	return nil
+}
+
+// MoveTags moves every tag to the latest commit with its own message, and pushes them at once.
+func (repo *Repo) MoveTags(tagMessages map[string]string) error {
+	var refspecs []string
+	for _, tag := range sortedKeys(tagMessages) {
+		if err := repo.Backend.Tag(repo.Dir, tag, tagMessages[tag], true); err != nil {
+			return fmt.Errorf("could not update local tag '%s': %w", tag, err)
+		}
+		refspecs = append(refspecs, "refs/tags/"+tag)
+	}
+
+	if len(refspecs) == 0 {
+		return nil
+	}
+
+	if err := repo.Backend.Push(repo.Dir, "origin", refspecs, true); err != nil {
+		return fmt.Errorf("could not push remote tags '%s': %w", strings.Join(sortedKeys(tagMessages), "', '"), err)
+	}
+
+	return nil
+}
+
+func (repo *Repo) AddOrMoveTag(tag string) error {
+	tagExists, err := repo.TagExists(tag)
+	if err != nil {
+		return fmt.Errorf("could not add or move tag '%s': %w", tag, err)
+	}
+
+	if !tagExists {
+		err = repo.AddTag(tag)
+	} else {
+		err = repo.MoveTag(tag)
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not add or move tag '%s': %w", tag, err)
+	}
+
+	return nil
+}
+
+// ExecGit runs git itself. Remotes on Host are authenticated by a credential helper that reads
+// the token of Credentials from the environment of the git process, so that the token is neither
+// part of remote URLs nor written to ".git/config".
+type ExecGit struct {
+	Host        string
+	Credentials TokenSource
+}
+
+func (ExecGit) run(dir string, args ...string) (string, error) {
+	out, err := runGitCommand(nil, append([]string{"-C", dir}, args...)...)
+	return out, classifyGitFailure(err)
+}
+
+// runWithRemote runs a command that talks to remote, which is the name or URL of a remote.
+func (backend ExecGit) runWithRemote(dir string, remote string, args ...string) (string, error) {
+	remoteUrl, err := backend.GetConfig(dir, fmt.Sprintf("remote.%s.url", remote))
+	if err != nil || remoteUrl == "" {
+		remoteUrl = remote
+	}
+
+	credentialArgs, credentialEnv, err := backend.gitCredentials(remoteUrl)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := runGitCommand(credentialEnv, append(credentialArgs, append([]string{"-C", dir}, args...)...)...)
+	return out, classifyGitFailure(err)
+}
+
+const gitCredentialTokenEnv = "GIT_SYNC_TOKEN"
+
+// gitCredentials replaces any configured credential helpers by one that answers with the token
+// for the owner of the repository at remoteUrl. Other remotes, e.g. local paths, get none.
+func (backend ExecGit) gitCredentials(remoteUrl string) ([]string, []string, error) {
+	if backend.Credentials == nil || !strings.HasPrefix(remoteUrl, fmt.Sprintf("https://%s/", backend.Host)) {
+		return nil, nil, nil
+	}
+
+	repository, err := ParseRepositoryURL(remoteUrl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owner, _, err := RepoOwnerName(repository)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	token, err := backend.Credentials.Token(owner)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get token for '%s': %w", repository, err)
+	}
+
+	credentialHelper := fmt.Sprintf(`!f() { test "$1" = get && echo username=x-access-token && echo "password=$%s"; }; f`, gitCredentialTokenEnv)
+	args := []string{"-c", "credential.helper=", "-c", "credential.helper=" + credentialHelper}
+	env := []string{gitCredentialTokenEnv + "=" + token, "GIT_TERMINAL_PROMPT=0"}
+
+	return args, env, nil
+}
+
+func (backend ExecGit) Clone(url string, dir string, branch string) error {
+	credentialArgs, credentialEnv, err := backend.gitCredentials(url)
+	if err != nil {
+		return err
+	}
+
+	args := append(credentialArgs, "clone", url, dir)
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+
+	_, err = runGitCommand(credentialEnv, args...)
+	return classifyGitFailure(err)
+}
+
+func (backend ExecGit) GetConfig(dir string, key string) (string, error) {
+	out, err := backend.run(dir, "config", "--get", key)
+	return strings.TrimSuffix(out, "\n"), err
+}
+
+func (backend ExecGit) SetConfig(dir string, key string, value string) error {
+	_, err := backend.run(dir, "config", key, value)
+	return err
+}
+
+func (backend ExecGit) SetRemoteURL(dir string, remote string, url string) error {
+	_, err := backend.run(dir, "remote", "set-url", remote, url)
+	return err
+}
+
+func (backend ExecGit) Status(dir string) ([]string, error) {
+	out, err := backend.run(dir, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, line := range splitLines(out) {
+		if len(line) > 3 {
+			paths = append(paths, line[3:])
+		}
+	}
+
+	return paths, nil
+}
+
+func (backend ExecGit) LocalBranches(dir string) ([]string, error) {
+	out, err := backend.run(dir, "branch", "--list", "--format=%(refname:short)")
+	if err != nil {
+		return nil, err
+	}
+
+	return splitLines(out), nil
+}
+
+func (backend ExecGit) Checkout(dir string, branch string, create bool) error {
+	args := []string{"checkout", branch}
+	if create {
+		args = []string{"checkout", "-b", branch}
+	}
+
+	_, err := backend.run(dir, args...)
+	return err
+}
+
+func (backend ExecGit) DeleteLocalBranch(dir string, branch string) error {
+	_, err := backend.run(dir, "branch", "-D", branch)
+	return err
+}
+
+func (backend ExecGit) Add(dir string, paths []string) error {
+	_, err := backend.run(dir, append([]string{"add", "--"}, paths...)...)
+	return err
+}
+
+func (backend ExecGit) Commit(dir string, message string) error {
+	_, err := backend.run(dir, "commit", "-m", message)
+	return err
+}
+
+func (backend ExecGit) Push(dir string, remote string, refspecs []string, force bool) error {
+	args := []string{"push", remote}
+	if force {
+		args = append(args, "--force")
+	}
+
+	_, err := backend.runWithRemote(dir, remote, append(args, refspecs...)...)
+	return err
+}
+
+func (backend ExecGit) ListRemoteRefs(dir string, remote string) ([]RemoteRef, error) {
+	out, err := backend.runWithRemote(dir, remote, "ls-remote", remote)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRemoteRefs(out), nil
+}
+
+func parseRemoteRefs(lsRemoteOutput string) []RemoteRef {
+	var refs []RemoteRef
+	refIndices := map[string]int{}
+
+	for _, line := range splitLines(lsRemoteOutput) {
+		hashName := strings.SplitN(line, "\t", 2)
+		if len(hashName) < 2 {
+			continue
+		}
+
+		// Annotated tags are listed twice, the "^{}" entry holds the commit they point to.
+		hash, name := hashName[0], hashName[1]
+		if peeledName, isPeeled := strings.CutSuffix(name, "^{}"); isPeeled {
+			if index, ok := refIndices[peeledName]; ok {
+				refs[index].Hash = hash
+				continue
+			}
+			name = peeledName
+		}
+
+		refIndices[name] = len(refs)
+		refs = append(refs, RemoteRef{Name: name, Hash: hash})
+	}
+
+	return refs
+}
+
+func (backend ExecGit) Tag(dir string, tag string, message string, force bool) error {
+	args := []string{"tag"}
+	if force {
+		args = append(args, "-f")
+	}
+	if message != "" {
+		args = append(args, "-a", "-m", message)
+	}
+
+	_, err := backend.run(dir, append(args, tag)...)
+	return err
+}
+
+// DeleteTag does not fail when the tag does not exist locally, e.g. when tags were not fetched.
+func (backend ExecGit) DeleteTag(dir string, tag string) error {
+	_, err := backend.run(dir, "update-ref", "-d", "refs/tags/"+tag)
+	return err
+}
+
+// TagMessage is empty for lightweight tags and tags that do not exist.
+func (backend ExecGit) TagMessage(dir string, tag string) (string, error) {
+	if _, err := backend.run(dir, "rev-parse", "--verify", "--quiet", "refs/tags/"+tag); err != nil {
+		return "", fmt.Errorf("'%s': %w", tag, ErrTagNotFound)
+	}
+
+	// Without the condition, lightweight tags would get the message of the commit they point to.
+	out, err := backend.run(dir, "tag", "--list", "--format=%(if:equals=tag)%(objecttype)%(then)%(contents)%(end)", tag)
+	return strings.TrimSpace(out), err
+}
+
+func (backend ExecGit) ChangedFiles(dir string, since string, paths []string) ([]FileChange, error) {
+	out, err := backend.run(dir, append([]string{"diff", "--name-status", "--no-renames", since, "HEAD", "--"}, paths...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseNameStatus(out), nil
+}
+
+func (backend ExecGit) Log(dir string, since string, paths []string) ([]string, error) {
+	out, err := backend.run(dir, append([]string{"log", "--format=%B%x00", since + "..HEAD", "--"}, paths...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []string
+	for _, message := range strings.Split(out, "\x00") {
+		if message = strings.TrimSpace(message); message != "" {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+func (backend ExecGit) ShowFile(dir string, ref string, path string) (string, error) {
+	return backend.run(dir, "show", ref+":"+path)
+}
+
+// ListFiles leaves out symbolic links and submodules, only regular files can be synced.
+func (backend ExecGit) ListFiles(dir string, ref string) ([]TreeFile, error) {
+	out, err := backend.run(dir, "ls-tree", "-r", "-z", "--full-tree", ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []TreeFile
+	for _, entry := range strings.Split(out, "\x00") {
+		modeTypePath := strings.SplitN(entry, " ", 3)
+		if len(modeTypePath) < 3 || modeTypePath[1] != "blob" {
+			continue
+		}
+
+		mode := fs.FileMode(0o644)
+		switch modeTypePath[0] {
+		case "100755":
+			mode = 0o755
+		case "120000":
+			continue
+		}
+
+		if _, filePath, ok := strings.Cut(modeTypePath[2], "\t"); ok {
+			files = append(files, TreeFile{Path: filePath, Mode: mode})
+		}
+	}
+
+	return files, nil
+}
+
+func (backend ExecGit) StagedChanges(dir string) ([]FileChange, error) {
+	out, err := backend.run(dir, "diff", "--cached", "--name-status", "--no-renames")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseNameStatus(out), nil
+}
+
+func parseNameStatus(nameStatusOutput string) []FileChange {
+	statuses := map[string]string{
+		"A": "added",
+		"D": "removed",
+		"M": "modified",
+	}
+
+	changes := []FileChange{}
+	for _, line := range splitLines(nameStatusOutput) {
+		statusPath := strings.SplitN(line, "\t", 2)
+		if len(statusPath) < 2 {
+			continue
+		}
+
+		status, ok := statuses[statusPath[0]]
+		if !ok {
+			status = "modified"
+		}
+
+		changes = append(changes, FileChange{Path: statusPath[1], Status: status})
+	}
+
+	return changes
+}
+
+func (backend ExecGit) StagedDiff(dir string) (string, error) {
+	return backend.run(dir, "diff", "--cached", "--no-color", "--no-renames")
+}
+
+func splitLines(out string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,844 @@
+package common
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryGit is an in-process GitBackend. Working trees are real directories, but commits,
+// branches, tags and remotes only exist in memory, so no `git` executable is needed.
+type MemoryGit struct {
+	mutex   sync.Mutex
+	remotes map[string]*MemoryRemote
+	repos   map[string]*memoryRepo
+}
+
+type MemoryCommit struct {
+	Hash    string
+	Message string
+	Parent  *MemoryCommit
+	Files   map[string]string
+}
+
+type MemoryRemote struct {
+	DefaultBranch string
+	Branches      map[string]*MemoryCommit
+	Tags          map[string]*MemoryCommit
+}
+
+type memoryRepo struct {
+	config      map[string]string
+	remotes     map[string]string
+	head        string
+	branches    map[string]*MemoryCommit
+	tags        map[string]*MemoryCommit
+	tagMessages map[string]string
+	index       map[string]string
+}
+
+func NewMemoryGit() *MemoryGit {
+	return &MemoryGit{
+		remotes: map[string]*MemoryRemote{},
+		repos:   map[string]*memoryRepo{},
+	}
+}
+
+func (backend *MemoryGit) AddRemote(url string, defaultBranch string, files map[string]string) *MemoryRemote {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	remote := &MemoryRemote{
+		DefaultBranch: defaultBranch,
+		Branches:      map[string]*MemoryCommit{defaultBranch: newMemoryCommit("initial commit", nil, files)},
+		Tags:          map[string]*MemoryCommit{},
+	}
+	backend.remotes[url] = remote
+
+	return remote
+}
+
+func (backend *MemoryGit) Remote(url string) *MemoryRemote {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	return backend.remotes[url]
+}
+
+func newMemoryCommit(message string, parent *MemoryCommit, files map[string]string) *MemoryCommit {
+	hash := sha1.New()
+	if parent != nil {
+		hash.Write([]byte(parent.Hash))
+	}
+	hash.Write([]byte(message))
+	for _, filePath := range sortedKeys(files) {
+		hash.Write([]byte(filePath + "\x00" + files[filePath] + "\x00"))
+	}
+
+	return &MemoryCommit{
+		Hash:    hex.EncodeToString(hash.Sum(nil)),
+		Message: message,
+		Parent:  parent,
+		Files:   copyFiles(files),
+	}
+}
+
+func (commit *MemoryCommit) hasAncestor(ancestor *MemoryCommit) bool {
+	for current := commit; current != nil; current = current.Parent {
+		if current.Hash == ancestor.Hash {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (backend *MemoryGit) repo(dir string) (*memoryRepo, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, ok := backend.repos[absDir]
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a git repository", dir)
+	}
+
+	return repo, nil
+}
+
+func (backend *MemoryGit) remote(repo *memoryRepo, name string) (*MemoryRemote, error) {
+	url, ok := repo.remotes[name]
+	if !ok {
+		return nil, fmt.Errorf("no such remote '%s'", name)
+	}
+
+	remote, ok := backend.remotes[url]
+	if !ok {
+		return nil, fmt.Errorf("could not read from remote repository '%s'", Secrets.Redact(url))
+	}
+
+	return remote, nil
+}
+
+func (backend *MemoryGit) Clone(url string, dir string, branch string) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	remote, ok := backend.remotes[url]
+	if !ok {
+		return fmt.Errorf("repository '%s' not found", Secrets.Redact(url))
+	}
+
+	if branch == "" {
+		branch = remote.DefaultBranch
+	}
+	commit, ok := remote.Branches[branch]
+	if !ok {
+		return fmt.Errorf("remote branch '%s': %w", branch, ErrBranchNotFound)
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := writeWorkingTree(absDir, nil, commit.Files); err != nil {
+		return err
+	}
+
+	backend.repos[absDir] = &memoryRepo{
+		config:      map[string]string{"remote.origin.url": url},
+		remotes:     map[string]string{"origin": url},
+		head:        branch,
+		branches:    map[string]*MemoryCommit{branch: commit},
+		tags:        map[string]*MemoryCommit{},
+		tagMessages: map[string]string{},
+		index:       copyFiles(commit.Files),
+	}
+
+	return nil
+}
+
+func (backend *MemoryGit) GetConfig(dir string, key string) (string, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return "", err
+	}
+
+	return repo.config[key], nil
+}
+
+func (backend *MemoryGit) SetConfig(dir string, key string, value string) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return err
+	}
+
+	repo.config[key] = value
+	return nil
+}
+
+func (backend *MemoryGit) SetRemoteURL(dir string, remote string, url string) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := repo.remotes[remote]; !ok {
+		return fmt.Errorf("no such remote '%s'", remote)
+	}
+
+	repo.remotes[remote] = url
+	repo.config[fmt.Sprintf("remote.%s.url", remote)] = url
+	return nil
+}
+
+func (backend *MemoryGit) Status(dir string) ([]string, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	workingTree, err := readWorkingTree(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	head := repo.branches[repo.head]
+	changed := map[string]bool{}
+	for _, filePath := range diffFiles(head.Files, repo.index) {
+		changed[filePath] = true
+	}
+	for _, filePath := range diffFiles(repo.index, workingTree) {
+		changed[filePath] = true
+	}
+
+	return sortedKeys(changed), nil
+}
+
+func (backend *MemoryGit) LocalBranches(dir string) ([]string, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedKeys(repo.branches), nil
+}
+
+func (backend *MemoryGit) Checkout(dir string, branch string, create bool) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return err
+	}
+
+	head := repo.branches[repo.head]
+
+	if create {
+		if _, exists := repo.branches[branch]; exists {
+			return fmt.Errorf("a branch named '%s' already exists", branch)
+		}
+		repo.branches[branch] = head
+		repo.head = branch
+		return nil
+	}
+
+	commit, ok := repo.branches[branch]
+	if !ok {
+		remote, err := backend.remote(repo, "origin")
+		if err != nil {
+			return err
+		}
+		if commit, ok = remote.Branches[branch]; !ok {
+			return fmt.Errorf("pathspec '%s' did not match any branch: %w", branch, ErrBranchNotFound)
+		}
+		repo.branches[branch] = commit
+	}
+
+	// Like `git checkout`, uncommitted changes are kept when the commit does not change.
+	if commit.Hash != head.Hash {
+		if err := writeWorkingTree(dir, head.Files, commit.Files); err != nil {
+			return err
+		}
+		repo.index = copyFiles(commit.Files)
+	}
+
+	repo.head = branch
+	return nil
+}
+
+func (backend *MemoryGit) DeleteLocalBranch(dir string, branch string) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := repo.branches[branch]; !ok {
+		return fmt.Errorf("branch '%s': %w", branch, ErrBranchNotFound)
+	}
+	if repo.head == branch {
+		return fmt.Errorf("cannot delete branch '%s' that is checked out", branch)
+	}
+
+	delete(repo.branches, branch)
+	return nil
+}
+
+func (backend *MemoryGit) Add(dir string, paths []string) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return err
+	}
+
+	workingTree, err := readWorkingTree(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, pathspec := range paths {
+		matched := false
+		for filePath, contents := range workingTree {
+			if matchesPathspec(filePath, pathspec) {
+				repo.index[filePath] = contents
+				matched = true
+			}
+		}
+		for filePath := range repo.index {
+			if _, exists := workingTree[filePath]; !exists && matchesPathspec(filePath, pathspec) {
+				delete(repo.index, filePath)
+				matched = true
+			}
+		}
+
+		if !matched {
+			return fmt.Errorf("pathspec '%s' did not match any files", pathspec)
+		}
+	}
+
+	return nil
+}
+
+func (backend *MemoryGit) Commit(dir string, message string) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return err
+	}
+
+	head := repo.branches[repo.head]
+	if len(diffFiles(head.Files, repo.index)) == 0 {
+		return fmt.Errorf("nothing to commit, working tree clean: %w", ErrNoChanges)
+	}
+
+	repo.branches[repo.head] = newMemoryCommit(message, head, repo.index)
+	return nil
+}
+
+func (backend *MemoryGit) Push(dir string, remoteName string, refspecs []string, force bool) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return err
+	}
+
+	remote, err := backend.remote(repo, remoteName)
+	if err != nil {
+		return err
+	}
+
+	for _, refspec := range refspecs {
+		source, destination, hasDestination := strings.Cut(refspec, ":")
+		if !hasDestination {
+			destination = source
+		}
+
+		remoteRefs := remote.Branches
+		localRefs := repo.branches
+		name, isTag := strings.CutPrefix(destination, "refs/tags/")
+		if isTag {
+			remoteRefs = remote.Tags
+			localRefs = repo.tags
+		} else {
+			name = strings.TrimPrefix(destination, "refs/heads/")
+		}
+
+		if source == "" {
+			if _, ok := remoteRefs[name]; !ok {
+				return fmt.Errorf("unable to delete '%s': remote ref does not exist", name)
+			}
+			delete(remoteRefs, name)
+			continue
+		}
+
+		commit, ok := localRefs[name]
+		if !ok {
+			return fmt.Errorf("src refspec '%s' does not match any", source)
+		}
+
+		if existing, exists := remoteRefs[name]; exists && !force {
+			if isTag && existing.Hash != commit.Hash {
+				return fmt.Errorf("! [rejected] %s (already exists)", name)
+			}
+			if !commit.hasAncestor(existing) {
+				return fmt.Errorf("! [rejected] %s (non-fast-forward)", name)
+			}
+		}
+
+		remoteRefs[name] = commit
+	}
+
+	return nil
+}
+
+func (backend *MemoryGit) ListRemoteRefs(dir string, remoteName string) ([]RemoteRef, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := backend.remote(repo, remoteName)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []RemoteRef
+	for _, branch := range sortedKeys(remote.Branches) {
+		refs = append(refs, RemoteRef{Name: "refs/heads/" + branch, Hash: remote.Branches[branch].Hash})
+	}
+	for _, tag := range sortedKeys(remote.Tags) {
+		refs = append(refs, RemoteRef{Name: "refs/tags/" + tag, Hash: remote.Tags[tag].Hash})
+	}
+
+	return refs, nil
+}
+
+func (backend *MemoryGit) Tag(dir string, tag string, message string, force bool) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return err
+	}
+
+	if _, exists := repo.tags[tag]; exists && !force {
+		return fmt.Errorf("tag '%s' already exists", tag)
+	}
+
+	repo.tags[tag] = repo.branches[repo.head]
+	repo.tagMessages[tag] = message
+	return nil
+}
+
+func (backend *MemoryGit) TagMessage(dir string, tag string) (string, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return "", err
+	}
+
+	if _, exists := repo.tags[tag]; !exists {
+		return "", fmt.Errorf("'%s': %w", tag, ErrTagNotFound)
+	}
+
+	return repo.tagMessages[tag], nil
+}
+
+func (backend *MemoryGit) DeleteTag(dir string, tag string) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return err
+	}
+
+	delete(repo.tags, tag)
+	delete(repo.tagMessages, tag)
+	return nil
+}
+
+func (backend *MemoryGit) ChangedFiles(dir string, since string, paths []string) ([]FileChange, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sinceCommit, err := repo.resolve(since)
+	if err != nil {
+		return nil, err
+	}
+
+	headCommit, err := repo.resolve("HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []FileChange{}
+	for _, filePath := range diffFiles(sinceCommit.Files, headCommit.Files) {
+		if matchesAnyPathspec(filePath, paths) {
+			changes = append(changes, FileChange{Path: filePath, Status: changeStatus(sinceCommit.Files, headCommit.Files, filePath)})
+		}
+	}
+
+	return changes, nil
+}
+
+func (backend *MemoryGit) Log(dir string, since string, paths []string) ([]string, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sinceCommit, err := repo.resolve(since)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []string
+	for commit := repo.branches[repo.head]; commit != nil && commit.Hash != sinceCommit.Hash; commit = commit.Parent {
+		parentFiles := map[string]string{}
+		if commit.Parent != nil {
+			parentFiles = commit.Parent.Files
+		}
+
+		for _, filePath := range diffFiles(parentFiles, commit.Files) {
+			if len(paths) == 0 || matchesAnyPathspec(filePath, paths) {
+				messages = append(messages, commit.Message)
+				break
+			}
+		}
+	}
+
+	return messages, nil
+}
+
+func (repo *memoryRepo) resolve(ref string) (*MemoryCommit, error) {
+	name := strings.TrimRight(ref, "^")
+	parentCount := len(ref) - len(name)
+	if name == "HEAD" {
+		name = repo.head
+	}
+
+	var commit *MemoryCommit
+	if tag, isTag := strings.CutPrefix(name, "refs/tags/"); isTag {
+		commit = repo.tags[tag]
+	} else if branch, isBranch := strings.CutPrefix(name, "refs/heads/"); isBranch {
+		commit = repo.branches[branch]
+	} else if branchCommit, ok := repo.branches[name]; ok {
+		commit = branchCommit
+	} else if tagCommit, ok := repo.tags[name]; ok {
+		commit = tagCommit
+	} else {
+		commit = repo.findCommit(name)
+	}
+	if commit == nil {
+		return nil, fmt.Errorf("unknown revision '%s'", ref)
+	}
+
+	for parent := 0; parent < parentCount; parent++ {
+		if commit = commit.Parent; commit == nil {
+			return nil, fmt.Errorf("unknown revision '%s'", ref)
+		}
+	}
+
+	return commit, nil
+}
+
+// findCommit looks for the commit with hash among the history of every branch and tag.
+func (repo *memoryRepo) findCommit(hash string) *MemoryCommit {
+	for _, heads := range []map[string]*MemoryCommit{repo.branches, repo.tags} {
+		for _, head := range heads {
+			for commit := head; commit != nil; commit = commit.Parent {
+				if commit.Hash == hash {
+					return commit
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// ListFiles lists every file as a regular file, modes are not kept in memory.
+func (backend *MemoryGit) ListFiles(dir string, ref string) ([]TreeFile, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := repo.resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []TreeFile
+	for _, filePath := range sortedKeys(commit.Files) {
+		files = append(files, TreeFile{Path: filePath, Mode: 0o644})
+	}
+
+	return files, nil
+}
+
+func (backend *MemoryGit) ShowFile(dir string, ref string, path string) (string, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return "", err
+	}
+
+	commit, err := repo.resolve(ref)
+	if err != nil {
+		return "", err
+	}
+
+	contents, ok := commit.Files[path]
+	if !ok {
+		return "", fmt.Errorf("path '%s' does not exist in '%s'", path, ref)
+	}
+
+	return contents, nil
+}
+
+func (backend *MemoryGit) StagedChanges(dir string) ([]FileChange, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	head := repo.branches[repo.head]
+	changes := []FileChange{}
+	for _, filePath := range diffFiles(head.Files, repo.index) {
+		changes = append(changes, FileChange{Path: filePath, Status: changeStatus(head.Files, repo.index, filePath)})
+	}
+
+	return changes, nil
+}
+
+func (backend *MemoryGit) StagedDiff(dir string) (string, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	repo, err := backend.repo(dir)
+	if err != nil {
+		return "", err
+	}
+
+	// Every changed file is shown as a single hunk, which is a valid but not a minimal diff.
+	head := repo.branches[repo.head]
+	var diff strings.Builder
+	for _, filePath := range diffFiles(head.Files, repo.index) {
+		oldLines := splitFileLines(head.Files[filePath])
+		newLines := splitFileLines(repo.index[filePath])
+
+		oldName, newName := "a/"+filePath, "b/"+filePath
+		if _, exists := head.Files[filePath]; !exists {
+			oldName = "/dev/null"
+		}
+		if _, exists := repo.index[filePath]; !exists {
+			newName = "/dev/null"
+		}
+
+		fmt.Fprintf(&diff, "diff --git a/%s b/%s\n--- %s\n+++ %s\n", filePath, filePath, oldName, newName)
+		fmt.Fprintf(&diff, "@@ -%s +%s @@\n", hunkRange(len(oldLines)), hunkRange(len(newLines)))
+		for _, line := range oldLines {
+			fmt.Fprintf(&diff, "-%s\n", line)
+		}
+		for _, line := range newLines {
+			fmt.Fprintf(&diff, "+%s\n", line)
+		}
+	}
+
+	return diff.String(), nil
+}
+
+func hunkRange(lineCount int) string {
+	if lineCount == 0 {
+		return "0,0"
+	}
+
+	return fmt.Sprintf("1,%v", lineCount)
+}
+
+func splitFileLines(contents string) []string {
+	if contents == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+}
+
+func changeStatus(before map[string]string, after map[string]string, filePath string) string {
+	_, existedBefore := before[filePath]
+	_, existsAfter := after[filePath]
+
+	if !existedBefore {
+		return "added"
+	}
+	if !existsAfter {
+		return "removed"
+	}
+
+	return "modified"
+}
+
+func diffFiles(before map[string]string, after map[string]string) []string {
+	changed := map[string]bool{}
+	for filePath, contents := range before {
+		if afterContents, exists := after[filePath]; !exists || afterContents != contents {
+			changed[filePath] = true
+		}
+	}
+	for filePath := range after {
+		if _, exists := before[filePath]; !exists {
+			changed[filePath] = true
+		}
+	}
+
+	return sortedKeys(changed)
+}
+
+func matchesAnyPathspec(filePath string, pathspecs []string) bool {
+	for _, pathspec := range pathspecs {
+		if matchesPathspec(filePath, pathspec) {
+			return true
+		}
+	}
+
+	return len(pathspecs) == 0
+}
+
+func matchesPathspec(filePath string, pathspec string) bool {
+	pathspec = strings.TrimSuffix(path.Clean(filepath.ToSlash(pathspec)), "/")
+	if pathspec == "." || filePath == pathspec || strings.HasPrefix(filePath, pathspec+"/") {
+		return true
+	}
+
+	matched, _ := path.Match(pathspec, filePath)
+	return matched
+}
+
+func readWorkingTree(dir string) (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+
+		contents, err := ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		files[filepath.ToSlash(relativePath)] = contents
+		return nil
+	})
+
+	return files, err
+}
+
+func writeWorkingTree(dir string, before map[string]string, after map[string]string) error {
+	for filePath := range before {
+		if _, exists := after[filePath]; !exists {
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(filePath))); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	for filePath, contents := range after {
+		fullPath := filepath.Join(dir, filepath.FromSlash(filePath))
+		if err := CreateDirectory(filepath.Dir(fullPath)); err != nil {
+			return err
+		}
+		if err := WriteFile(fullPath, contents); err != nil {
+			return err
+		}
+	}
+
+	return CreateDirectory(dir)
+}
+
+func copyFiles(files map[string]string) map[string]string {
+	copied := map[string]string{}
+	for filePath, contents := range files {
+		copied[filePath] = contents
+	}
+
+	return copied
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,311 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var conformanceFiles = map[string]string{
+	"README.md":                    "# Component\n",
+	".github/workflows/build.yaml": "name: Build\n",
+}
+
+// gitBackends set up the same remote "org/component" for every backend, so that the scenarios of
+// the conformance test run against each of them.
+var gitBackends = []struct {
+	name  string
+	setup func(t *testing.T) (GitBackend, func(repo string) string)
+}{
+	{"ExecGit", setupExecGit},
+	{"MemoryGit", setupMemoryGit},
+}
+
+func setupExecGit(t *testing.T) (GitBackend, func(repo string) string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	remoteDir := filepath.Join(t.TempDir(), "component.git")
+	seedDir := t.TempDir()
+	writeFiles(t, seedDir, conformanceFiles)
+
+	for _, args := range [][]string{
+		{"init", "--quiet", "--bare", "--initial-branch=main", remoteDir},
+		{"-C", seedDir, "init", "--quiet", "--initial-branch=main"},
+		{"-C", seedDir, "add", "."},
+		{"-C", seedDir, "-c", "user.name=seed", "-c", "user.email=seed@example.com", "commit", "--quiet", "-m", "initial commit"},
+		{"-C", seedDir, "push", "--quiet", remoteDir, "main"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	return ExecGit{}, func(repo string) string { return remoteDir }
+}
+
+func setupMemoryGit(t *testing.T) (GitBackend, func(repo string) string) {
+	backend := NewMemoryGit()
+	backend.AddRemote("memory://org/component", "main", conformanceFiles)
+
+	return backend, func(repo string) string { return "memory://" + repo }
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for filePath, contents := range files {
+		fullPath := filepath.Join(dir, filepath.FromSlash(filePath))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func cloneForConformance(t *testing.T, backend GitBackend, remoteURL func(repo string) string) *Repo {
+	t.Helper()
+
+	repo := &Repo{Dir: filepath.Join(t.TempDir(), "component"), Backend: backend, RemoteURL: remoteURL}
+	if err := repo.Clone("org/component", "main"); err != nil {
+		t.Fatalf("Clone() returned an error: %v", err)
+	}
+	if err := repo.SetupGitHubUser(GitUser{Name: "bot", Email: "bot@example.com"}); err != nil {
+		t.Fatalf("SetupGitHubUser() returned an error: %v", err)
+	}
+
+	return repo
+}
+
+func TestGitBackendConformance(t *testing.T) {
+	for _, gitBackend := range gitBackends {
+		t.Run(gitBackend.name, func(t *testing.T) {
+			t.Run("clone", func(t *testing.T) {
+				backend, remoteURL := gitBackend.setup(t)
+				repo := cloneForConformance(t, backend, remoteURL)
+
+				contents, err := ReadFile(filepath.Join(repo.Dir, "README.md"))
+				if err != nil || contents != conformanceFiles["README.md"] {
+					t.Errorf("clone contains README.md %q (%v), expected %q", contents, err, conformanceFiles["README.md"])
+				}
+
+				if branches, err := backend.LocalBranches(repo.Dir); err != nil || !slices.Equal(branches, []string{"main"}) {
+					t.Errorf("LocalBranches() returned %v (%v), expected [main]", branches, err)
+				}
+
+				files, err := backend.ListFiles(repo.Dir, "HEAD")
+				if err != nil {
+					t.Fatalf("ListFiles() returned an error: %v", err)
+				}
+				var filePaths []string
+				for _, file := range files {
+					filePaths = append(filePaths, file.Path)
+				}
+				if expected := sortedKeys(conformanceFiles); !slices.Equal(filePaths, expected) {
+					t.Errorf("ListFiles() returned %v, expected %v", filePaths, expected)
+				}
+
+				if contents, err := repo.GetFileAt("HEAD", "README.md"); err != nil || contents != conformanceFiles["README.md"] {
+					t.Errorf("GetFileAt() returned %q (%v), expected %q", contents, err, conformanceFiles["README.md"])
+				}
+
+				err = (&Repo{Dir: t.TempDir(), Backend: backend, RemoteURL: remoteURL}).Clone("org/component", "missing")
+				if err == nil {
+					t.Errorf("Clone() of a missing branch did not return an error")
+				}
+			})
+
+			t.Run("commit and push", func(t *testing.T) {
+				backend, remoteURL := gitBackend.setup(t)
+				repo := cloneForConformance(t, backend, remoteURL)
+
+				if err := repo.CommitAndPush("main", []string{"."}); !errors.Is(err, ErrNoChanges) {
+					t.Errorf("CommitAndPush() of a clean tree returned %v, expected ErrNoChanges", err)
+				}
+
+				writeFiles(t, repo.Dir, map[string]string{".github/workflows/synced_test.yaml": "name: Test\n"})
+				if clean, err := repo.IsWorkingTreeClean(); err != nil || clean {
+					t.Errorf("IsWorkingTreeClean() returned %v (%v) with an untracked file", clean, err)
+				}
+
+				if err := repo.CreateAndPushToNewBranch("sync-workflows", "main", []string{".github/workflows"}); err != nil {
+					t.Fatalf("CreateAndPushToNewBranch() returned an error: %v", err)
+				}
+				if exists, err := repo.RemoteBranchExists("sync-workflows"); err != nil || !exists {
+					t.Errorf("RemoteBranchExists() returned %v (%v) after pushing", exists, err)
+				}
+
+				other := cloneForConformance(t, backend, remoteURL)
+				if err := other.CheckoutExistingBranch("sync-workflows"); err != nil {
+					t.Fatalf("CheckoutExistingBranch() returned an error: %v", err)
+				}
+				if contents, err := ReadFile(filepath.Join(other.Dir, ".github/workflows/synced_test.yaml")); err != nil || contents != "name: Test\n" {
+					t.Errorf("pushed file contains %q (%v)", contents, err)
+				}
+
+				writeFiles(t, other.Dir, map[string]string{".github/workflows/synced_test.yaml": "name: Tests\n"})
+				if err := other.Add([]string{"."}); err != nil {
+					t.Fatalf("Add() returned an error: %v", err)
+				}
+				changes, err := other.StagedChanges()
+				if err != nil || len(changes) != 1 || changes[0] != (FileChange{Path: ".github/workflows/synced_test.yaml", Status: "modified"}) {
+					t.Errorf("StagedChanges() returned %+v (%v)", changes, err)
+				}
+				if err := other.CommitAndPush("sync-workflows", []string{"."}); err != nil {
+					t.Fatalf("CommitAndPush() returned an error: %v", err)
+				}
+
+				// The first clone is behind now, so pushing without force is rejected.
+				writeFiles(t, repo.Dir, map[string]string{"other.txt": "other\n"})
+				if err := repo.CommitAndPush("sync-workflows", []string{"."}); err == nil {
+					t.Errorf("CommitAndPush() of a branch that is behind did not return an error")
+				}
+
+				if err := repo.CheckoutExistingBranch("missing"); !errors.Is(err, ErrBranchNotFound) {
+					t.Errorf("CheckoutExistingBranch() of a missing branch returned %v, expected ErrBranchNotFound", err)
+				}
+			})
+
+			t.Run("branches", func(t *testing.T) {
+				backend, remoteURL := gitBackend.setup(t)
+				repo := cloneForConformance(t, backend, remoteURL)
+
+				writeFiles(t, repo.Dir, map[string]string{"feature.txt": "feature\n"})
+				if err := repo.CreateAndPushToNewBranch("feature", "main", []string{"feature.txt"}); err != nil {
+					t.Fatalf("CreateAndPushToNewBranch() returned an error: %v", err)
+				}
+
+				if err := repo.DeleteBranch("feature", "main"); err != nil {
+					t.Fatalf("DeleteBranch() returned an error: %v", err)
+				}
+				if exists, err := repo.LocalBranchExists("feature"); err != nil || exists {
+					t.Errorf("LocalBranchExists() returned %v (%v) after deleting", exists, err)
+				}
+				if exists, err := repo.RemoteBranchExists("feature"); err != nil || exists {
+					t.Errorf("RemoteBranchExists() returned %v (%v) after deleting", exists, err)
+				}
+				if PathExists(filepath.Join(repo.Dir, "feature.txt")) {
+					t.Errorf("checking out 'main' kept the file of the deleted branch")
+				}
+			})
+
+			t.Run("tags", func(t *testing.T) {
+				backend, remoteURL := gitBackend.setup(t)
+				repo := cloneForConformance(t, backend, remoteURL)
+
+				if _, err := repo.GetTagMessage("v1"); !errors.Is(err, ErrTagNotFound) {
+					t.Errorf("GetTagMessage() of a missing tag returned %v, expected ErrTagNotFound", err)
+				}
+
+				if err := repo.AddOrMoveTag("v1"); err != nil {
+					t.Fatalf("AddOrMoveTag() returned an error: %v", err)
+				}
+				if message, err := repo.GetTagMessage("v1"); err != nil || message != "" {
+					t.Errorf("GetTagMessage() of a lightweight tag returned %q (%v)", message, err)
+				}
+
+				writeFiles(t, repo.Dir, map[string]string{".github/workflows/build.yaml": "name: Build and Test\n", "docs.md": "docs\n"})
+				if err := repo.CommitAndPush("main", []string{"."}); err != nil {
+					t.Fatalf("CommitAndPush() returned an error: %v", err)
+				}
+
+				// Only committed changes count, not files in the working tree.
+				writeFiles(t, repo.Dir, map[string]string{"untracked.txt": "untracked\n", "README.md": "uncommitted\n"})
+				changes, err := repo.GetChangesSince("v1")
+				expectedChanges := []FileChange{{Path: ".github/workflows/build.yaml", Status: "modified"}, {Path: "docs.md", Status: "added"}}
+				if err != nil || !slices.Equal(changes, expectedChanges) {
+					t.Errorf("GetChangesSince() returned %+v (%v), expected %+v", changes, err, expectedChanges)
+				}
+				if files, err := repo.GetFilesChangedSince("v1", ".github"); err != nil || !slices.Equal(files, []string{".github/workflows/build.yaml"}) {
+					t.Errorf("GetFilesChangedSince() returned %v (%v)", files, err)
+				}
+				if messages, err := repo.GetCommitMessagesSince("v1"); err != nil || !slices.Equal(messages, []string{"sync workflows"}) {
+					t.Errorf("GetCommitMessagesSince() returned %v (%v)", messages, err)
+				}
+				if contents, err := repo.GetFileAt("v1", ".github/workflows/build.yaml"); err != nil || contents != conformanceFiles[".github/workflows/build.yaml"] {
+					t.Errorf("GetFileAt() returned %q (%v) at 'v1'", contents, err)
+				}
+
+				commitsBefore, err := repo.GetTagCommits()
+				if err != nil {
+					t.Fatalf("GetTagCommits() returned an error: %v", err)
+				}
+				if err := repo.AddOrMoveTag("v1"); err != nil {
+					t.Fatalf("AddOrMoveTag() returned an error: %v", err)
+				}
+				commitsAfter, err := repo.GetTagCommits()
+				if err != nil {
+					t.Fatalf("GetTagCommits() returned an error: %v", err)
+				}
+				if commitsBefore["v1"] == "" || commitsBefore["v1"] == commitsAfter["v1"] {
+					t.Errorf("AddOrMoveTag() did not move 'v1' from %q, it points to %q", commitsBefore["v1"], commitsAfter["v1"])
+				}
+				if message, err := repo.GetTagMessage("v1"); err != nil || message != "Update tag `v1` to latest commit" {
+					t.Errorf("GetTagMessage() of a moved tag returned %q (%v)", message, err)
+				}
+
+				if _, err := repo.GetChangesSince("v2"); !errors.Is(err, ErrTagNotFound) {
+					t.Errorf("GetChangesSince() of a missing tag returned %v, expected ErrTagNotFound", err)
+				}
+
+				if err := repo.DeleteTag("v1"); err != nil {
+					t.Fatalf("DeleteTag() returned an error: %v", err)
+				}
+				if exists, err := repo.TagExists("v1"); err != nil || exists {
+					t.Errorf("TagExists() returned %v (%v) after deleting", exists, err)
+				}
+			})
+		})
+	}
+}
+
+func TestExecGitCredentials(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	const token = "ghs_credential-helper-token"
+	config := &Config{Host: "ghes.example.com", Tokens: ownerTokens{"org": token}}
+	backend := config.GitBackend().(ExecGit)
+
+	remoteUrl := config.RemoteURL("org/component")
+	if strings.Contains(remoteUrl, token) {
+		t.Errorf("RemoteURL() = %q, expected it to not contain the token", remoteUrl)
+	}
+
+	args, env, err := backend.gitCredentials(remoteUrl)
+	if err != nil {
+		t.Fatalf("gitCredentials() returned an error: %v", err)
+	}
+	if strings.Contains(strings.Join(args, " "), token) {
+		t.Errorf("gitCredentials() returned the arguments %q, expected them to not contain the token", args)
+	}
+	if !slices.Contains(env, gitCredentialTokenEnv+"="+token) {
+		t.Errorf("gitCredentials() returned the environment %q, expected it to contain the token", env)
+	}
+
+	// The credential helper answers git with the token from the environment.
+	command := exec.Command("git", append(args, "credential", "fill")...)
+	command.Env = append(os.Environ(), env...)
+	command.Stdin = strings.NewReader("protocol=https\nhost=ghes.example.com\npath=org/component.git\n\n")
+	out, err := command.Output()
+	if err != nil {
+		t.Fatalf("git credential fill returned an error: %v", err)
+	}
+	if !strings.Contains(string(out), "username=x-access-token\n") || !strings.Contains(string(out), "password="+token+"\n") {
+		t.Errorf("git credential fill returned %q, expected the token", out)
+	}
+
+	for _, otherUrl := range []string{"https://github.com/org/component.git", filepath.Join(t.TempDir(), "component.git")} {
+		if args, env, err := backend.gitCredentials(otherUrl); err != nil || args != nil || env != nil {
+			t.Errorf("gitCredentials(%q) returned %q, %q (%v), expected no credentials", otherUrl, args, env, err)
+		}
+	}
+}
@@ -7,576 +7,308 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"os/exec"
-	"regexp"
-	"strconv"
 	"strings"
+	"time"
 
 	gogithub "github.com/google/go-github/v62/github"
 )
 
-func runCommand(name string, args ...string) (string, error) {
+const (
+	MergeableStateClean   = "clean"
+	MergeableStateUnknown = "unknown"
+)
+
+const (
+	mergeableStateAttempts = 5
+	mergeableStateInterval = 2 * time.Second
+)
+
+// runCommand runs the command with env added to the environment of this process.
+func runCommand(env []string, name string, args ...string) (string, error) {
 	command := exec.Command(name, args...)
+	if len(env) > 0 {
+		command.Env = append(os.Environ(), env...)
+	}
 	var stdout, stderr bytes.Buffer
-	command.Stdout = io.MultiWriter(os.Stdout, &stdout)
-	command.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	redactedStdout, redactedStderr := NewRedactingWriter(os.Stdout), NewRedactingWriter(os.Stderr)
+	command.Stdout = io.MultiWriter(redactedStdout, &stdout)
+	command.Stderr = io.MultiWriter(redactedStderr, &stderr)
 
-	log.Printf("> %s %s", name, sanitize(strings.Join(args, " ")))
+	log.Printf("> %s %s", name, strings.Join(args, " "))
 
 	err := command.Run()
-	if err != nil && stderr.Len() > 0 {
-		err = fmt.Errorf("%s", stderr.String())
+	redactedStdout.Flush()
+	redactedStderr.Flush()
+	if err != nil {
+		return stdout.String(), Redact(&CommandError{Command: name, Stderr: strings.TrimSpace(stderr.String()), Err: err})
 	}
 
-	return stdout.String(), err
+	return stdout.String(), nil
 }
 
-func RepoOwnerName(repo string) (string, string) {
-	ownerNameSlice := strings.Split(repo, "/")
-	if len(ownerNameSlice) < 2 {
-		panic(errors.New("repository identifier was not in the correct format (i.e. \"owner/name\")"))
+func RepoOwnerName(repo string) (string, string, error) {
+	if !isRepoIdentifier(repo) {
+		return "", "", fmt.Errorf("'%s': %w", repo, ErrInvalidRepository)
 	}
-	return ownerNameSlice[0], ownerNameSlice[1]
-}
 
-func SetupGitHubUser() {
-	runCommand("git", "config", "user.name", "workflow-sync-bot")
-	runCommand("git", "config", "user.email", "workflow-sync.bot@example.com")
+	owner, name, _ := strings.Cut(repo, "/")
+	return owner, name, nil
 }
 
-func GetEnv(key string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		log.Fatalf("no '%s' provided in ENV", key)
+// WriteJobSummary writes to the log when there is no job summary, e.g. outside of GitHub Actions.
+func WriteJobSummary(config *Config, contents string) error {
+	if config.SummaryPath == "" {
+		log.Printf("Job summary:\n%s\n", contents)
+		return nil
+	}
+
+	if err := WriteFile(config.SummaryPath, Secrets.Redact(contents)); err != nil {
+		return fmt.Errorf("could not write job summary to '%s': %w", config.SummaryPath, err)
 	}
-	return value
-}
 
-func WriteJobSummary(contents string) {
-	WriteFile(GetEnv("GITHUB_STEP_SUMMARY"), contents)
+	return nil
 }
 
-func getClientToken() string {
-	return GetEnv("GH_PAT_MF")
+// redactedError hides secrets in the message of the error it wraps, which errors.Is and errors.As
+// still see.
+type redactedError struct {
+	err error
 }
 
-func getApproverClientToken() string {
-	return GetEnv("GH_PAT_AYYXD")
+func (err *redactedError) Error() string {
+	return Secrets.Redact(err.err.Error())
 }
 
-func sanitize(log string) string {
-	sanitizied := log
-	sensitiveStrings := []string{
-		getClientToken(),
-		getApproverClientToken(),
-	}
+func (err *redactedError) Unwrap() error {
+	return err.err
+}
 
-	for _, sensitiveString := range sensitiveStrings {
-		sanitizied = strings.ReplaceAll(sanitizied, sensitiveString, "<token>")
+func Redact(err error) error {
+	var alreadyRedacted *redactedError
+	if err == nil || errors.As(err, &alreadyRedacted) {
+		return err
 	}
 
-	return sanitizied
+	return &redactedError{err: err}
 }
 
-func getClient() *gogithub.Client {
-	return gogithub.NewClient(nil).WithAuthToken(getClientToken())
+func newRetryingClient(host string) (*gogithub.Client, error) {
+	return withHost(gogithub.NewClient(&http.Client{Transport: NewRetryTransport(nil, DefaultRetryPolicy)}), host)
 }
 
-func getApproverClient() *gogithub.Client {
-	return gogithub.NewClient(nil).WithAuthToken(getApproverClientToken())
+func newAuthenticatedClient(host string, source TokenSource) (*gogithub.Client, error) {
+	transport := &tokenTransport{base: NewRetryTransport(nil, DefaultRetryPolicy), source: source}
+	return withHost(gogithub.NewClient(&http.Client{Transport: transport}), host)
 }
 
-func GetCurrentWorkflowRun() (*gogithub.WorkflowRun, error) {
+func GetCurrentWorkflowRun(api GitHubAPI, config *Config) (*gogithub.WorkflowRun, error) {
 	ctx := context.Background()
-	client := getClient()
-
-	owner, name := RepoOwnerName(GetEnv("GO_FILE_REPO"))
-	workflowRunString := GetEnv("GH_WORKFLOW_RUN_ID")
 
-	runId, err := strconv.ParseInt(workflowRunString, 10, 64)
+	owner, name, err := RepoOwnerName(config.SourceRepository)
 	if err != nil {
-		return nil, fmt.Errorf("could not convert '%s' to int64: %v", workflowRunString, err)
+		return nil, err
 	}
 
-	workflowRun, response, err := client.Actions.GetWorkflowRunByID(ctx, owner, name, runId)
-	if err != nil || !isOk(response) {
-		format := "could not get workflow run #%v: %v"
-		if err != nil {
-			return nil, fmt.Errorf(format, runId, err)
-		}
-		return nil, fmt.Errorf(format, runId, response.Body)
+	workflowRun, err := api.GetWorkflowRun(ctx, owner, name, config.WorkflowRunId)
+	if err != nil {
+		return nil, fmt.Errorf("could not get workflow run #%v: %w", config.WorkflowRunId, err)
 	}
 
 	return workflowRun, nil
 }
 
-func SetOrigin(repo string) error {
-	repoUrl := fmt.Sprintf("https://workflow-sync-bot:%s@github.com/%s.git", getClientToken(), repo)
-	if _, err := runCommand("git", "remote", "set-url", "origin", repoUrl); err != nil {
-		return fmt.Errorf("could not set url to git repository '%s': %v", repo, err)
-	}
-
-	return nil
-}
-
-func CloneRepository(repo string, dir string) error {
-	if PathExists(dir) {
-		DeleteDirectory(dir)
-	}
-
-	repoUrl := fmt.Sprintf("https://workflow-sync-bot:%s@github.com/%s.git", getClientToken(), repo)
-	if _, err := runCommand("git", "clone", repoUrl, dir); err != nil {
-		return fmt.Errorf("could not clone git repository '%s' to '%s': %v", repo, dir, err)
-	}
-
-	if err := SetOrigin(repo); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func GetDefaultBranch(owner string, name string) (string, error) {
+func GetDefaultBranch(api GitHubAPI, owner string, name string) (string, error) {
 	ctx := context.Background()
-	client := getClient()
 
-	repoInfo, _, err := client.Repositories.Get(ctx, owner, name)
+	repoInfo, err := api.GetRepository(ctx, owner, name)
 	if err != nil {
-		return "", fmt.Errorf("could not get repository info from '%s/%s': %v", owner, name, err)
+		return "", fmt.Errorf("could not get repository info from '%s/%s': %w", owner, name, err)
 	}
 	return repoInfo.GetDefaultBranch(), nil
 }
 
-func ExecInDir(dir string, exec func() error) error {
-	workingDir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("could not get working directory: %v", err)
-	}
-
-	if err := os.Chdir(dir); err != nil {
-		return fmt.Errorf("could not change directory to '%s': %v", dir, err)
-	}
-
-	if execErr := exec(); execErr != nil {
-		if err := os.Chdir(workingDir); err != nil {
-			return fmt.Errorf("could not change directory back to '%s': %v", dir, err)
-		}
-		return execErr
-	}
-
-	if err := os.Chdir(workingDir); err != nil {
-		return fmt.Errorf("could not change directory back to '%s': %v", dir, err)
-	}
-
-	return nil
-}
-
-func RemoteBranchExists(owner string, name string, branch string) (bool, error) {
+// GetRemoteFile reads a file from a branch or commit of a repository without cloning it. It
+// returns false when the file does not exist.
+func GetRemoteFile(api GitHubAPI, owner string, name string, path string, ref string) (string, bool, error) {
 	ctx := context.Background()
-	client := getClient()
-
-	branchInfo, response, err := client.Repositories.GetBranch(ctx, owner, name, branch, 1)
-	if response.StatusCode == 404 {
-		return false, nil
-	}
-	if err != nil {
-		return false, fmt.Errorf("could not get remote branch info from '%s/%s@%s': %v", owner, name, branch, err)
-	}
-
-	return branchInfo != nil, nil
-}
 
-func GetFilesChangedSince(tag string, dir string) ([]string, error) {
-	out, err := runCommand("git", "diff", "--name-only", tag, "--", dir)
+	fileContents, err := api.GetFileContents(ctx, owner, name, path, ref)
 	if err != nil {
-		return nil, fmt.Errorf("could not check if working tree was clean: %v", err)
+		return "", false, fmt.Errorf("could not get '%s' from '%s/%s@%s': %w", path, owner, name, ref, err)
 	}
-
-	if out == "" {
-		return []string{}, nil
+	if fileContents == nil {
+		return "", false, nil
 	}
 
-	var filesChanged []string
-	for _, fileChanged := range strings.Split(out, "\n") {
-		if len(fileChanged) > 0 {
-			filesChanged = append(filesChanged, fileChanged)
-		}
-	}
-
-	return filesChanged, nil
-}
-
-func GetFilesChangedInLastCommit(dir string) ([]string, error) {
-	return GetFilesChangedSince("HEAD^", dir)
-}
-
-func IsWorkingTreeClean() (bool, error) {
-	out, err := runCommand("git", "status", "--porcelain")
+	contents, err := fileContents.GetContent()
 	if err != nil {
-		return false, fmt.Errorf("could not check if working tree was clean: %v", err)
+		return "", false, fmt.Errorf("could not decode '%s' from '%s/%s@%s': %w", path, owner, name, ref, err)
 	}
 
-	return string(out) == "", nil
+	return contents, true, nil
 }
 
-func LocalBranchExists(branch string) (bool, error) {
-	out, err := runCommand("git", "branch", "--list", branch)
-	if err != nil {
-		return false, fmt.Errorf("could not check if branch '%s' exists locally: %v", branch, err)
-	}
-
-	return string(out) != "", nil
-}
-
-func DeleteLocalBranch(branch string) error {
-	if _, err := runCommand("git", "branch", "-D", branch); err != nil {
-		return fmt.Errorf("could not delete local branch '%s': %v", branch, err)
-	}
-
-	return nil
-}
-
-func DeleteRemoteBranch(branch string) error {
-	if _, err := runCommand("git", "push", "origin", "--delete", branch); err != nil {
-		return fmt.Errorf("could not delete remote branch '%s': %v", branch, err)
-	}
-
-	return nil
-}
-
-func CheckoutNewBranch(branch string) error {
-	if _, err := runCommand("git", "checkout", "-b", branch); err != nil {
-		return fmt.Errorf("could not checkout new branch '%s': %v", branch, err)
-	}
-
-	return nil
-}
-
-func CheckoutExistingBranch(branch string) error {
-	if _, err := runCommand("git", "checkout", branch); err != nil {
-		return fmt.Errorf("could not checkout existing branch '%s': %v", branch, err)
-	}
-
-	return nil
-}
-
-func GetCurrentRepository() (string, error) {
-	repoUrl, err := runCommand("git", "config", "--get", "remote.origin.url")
-	if err != nil {
-		return "", fmt.Errorf("could not get current repository: %v", err)
-	}
-	if repoUrl == "" {
-		return "", fmt.Errorf("could not get current repository, it returned \"\"")
-	}
-
-	// E.g. "https://github.com/workflow-sync-poc/common.git" -> "workflow-sync-poc/common"
-	repoFromUrlPattern := regexp.MustCompile(`https:\/\/github\.com\/(?P<Repo>[^\.\n]+)`)
-	repoFromUrlSubmatches := repoFromUrlPattern.FindStringSubmatch(repoUrl)
-	repoFromUrlSubmatchIndex := repoFromUrlPattern.SubexpIndex("Repo")
-	repo := string(repoFromUrlSubmatches[repoFromUrlSubmatchIndex])
-
-	return repo, nil
-}
+// ListRemoteFiles lists the files of a branch or commit of a repository without cloning it.
+func ListRemoteFiles(api GitHubAPI, owner string, name string, ref string) ([]TreeFile, error) {
+	ctx := context.Background()
 
-func DeleteBranch(owner string, name string, branch string) error {
-	defaultBranch, err := GetDefaultBranch(owner, name)
+	tree, err := api.GetTree(ctx, owner, name, ref)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("could not list files of '%s/%s@%s': %w", owner, name, ref, err)
 	}
-
-	if err := CheckoutExistingBranch(defaultBranch); err != nil {
-		return err
+	if tree.GetTruncated() {
+		return nil, fmt.Errorf("could not list files of '%s/%s@%s', there are too many", owner, name, ref)
 	}
 
-	if exists, err := LocalBranchExists(branch); err != nil {
-		return err
-	} else if exists {
-		if err := DeleteLocalBranch(branch); err != nil {
-			return err
+	var files []TreeFile
+	for _, entry := range tree.Entries {
+		if entry.GetType() == "blob" {
+			files = append(files, TreeFile{Path: entry.GetPath()})
 		}
 	}
 
-	if exists, err := RemoteBranchExists(owner, name, branch); err != nil {
-		return err
-	} else if exists {
-		if err := DeleteRemoteBranch(branch); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func CreateAndPushToNewBranch(owner string, name string, branch string) (bool, error) {
-	if err := DeleteBranch(owner, name, branch); err != nil {
-		return false, fmt.Errorf("could not delete old '%s' branch: %w", branch, err)
-	}
-
-	if _, err := runCommand("git", "checkout", "-b", branch); err != nil {
-		return false, fmt.Errorf("could not create branch '%s': %v", branch, err)
-	}
-
-	if _, err := runCommand("git", "add", ".github/workflows"); err != nil {
-		return false, fmt.Errorf("could not add workflows: %v", err)
-	}
-
-	if clean, err := IsWorkingTreeClean(); err != nil {
-		return false, err
-	} else if clean {
-		log.Println("No changes to commit, we are up to date!")
-		return false, nil
-	}
-
-	if _, err := runCommand("git", "commit", "-m", "sync workflows"); err != nil {
-		return false, fmt.Errorf("could not commit changes: %v", err)
-	}
-
-	if _, err := runCommand("git", "push", "-u", "origin", branch); err != nil {
-		return false, fmt.Errorf("could not push to remote '%s': %v", branch, err)
-	}
-
-	return true, nil
+	return files, nil
 }
 
-func GetLatestVersionTag(repo string) (string, error) {
-	err := SetOrigin(repo)
-	if err != nil {
-		return "", err
-	}
+func RemoteBranchExists(api GitHubAPI, owner string, name string, branch string) (bool, error) {
+	ctx := context.Background()
 
-	output, err := runCommand("bash", "-c", `git ls-remote --tags origin | grep -o 'refs/tags/v.*' | sed 's#refs/tags/##; s#\^{}##' | sort -V | tail -n1`)
+	branchInfo, err := api.GetBranch(ctx, owner, name, branch)
 	if err != nil {
-		return "", fmt.Errorf("could not get latest tag: %v", err)
+		return false, fmt.Errorf("could not get remote branch info from '%s/%s@%s': %w", owner, name, branch, err)
 	}
 
-	latestTag := strings.TrimSuffix(string(output), "\n")
-	return latestTag, nil
+	return branchInfo != nil, nil
 }
 
-func AddTag(tag string) error {
-	if _, err := runCommand("git", "tag", tag); err != nil {
-		return fmt.Errorf("could not update local tag '%s': %v", tag, err)
-	}
-
-	if _, err := runCommand("git", "push", "origin", tag); err != nil {
-		return fmt.Errorf("could not push remote tag '%s': %v", tag, err)
-	}
-
-	return nil
+func PullRequestBody(workflowRun *gogithub.WorkflowRun, versionTag string) string {
+	return fmt.Sprintf("Updates the synced workflows to `%s`.\r\n\r\n*Automatically generated from [workflow run **%s** #%v](%s) in [%s](%s).*", versionTag, *workflowRun.Name, *workflowRun.RunNumber, *workflowRun.HTMLURL, *workflowRun.Repository.FullName, *workflowRun.Repository.HTMLURL)
 }
 
-func MoveTag(tag string) error {
-	// See recommendation from https://github.com/actions/toolkit/blob/master/docs/action-versioning.md
-	if _, err := runCommand("git", "tag", "-fa", tag, "-m", fmt.Sprintf("Update tag `%s` to latest commit", tag)); err != nil {
-		return fmt.Errorf("could not update local tag '%s': %v", tag, err)
-	}
+func FindOpenPullRequest(api GitHubAPI, owner string, name string, branch string, baseBranch string) (*gogithub.PullRequest, error) {
+	ctx := context.Background()
 
-	if _, err := runCommand("git", "push", "origin", tag, "--force"); err != nil {
-		return fmt.Errorf("could not push remote tag '%s': %v", tag, err)
+	pullRequests, err := api.ListPullRequests(ctx, owner, name, &gogithub.PullRequestListOptions{
+		State: "open",
+		Head:  fmt.Sprintf("%s:%s", owner, branch),
+		Base:  baseBranch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list open pull requests from '%s' to '%s': %w", branch, baseBranch, err)
 	}
 
-	return nil
-}
-
-func TagExists(tag string) (bool, error) {
-	if _, err := runCommand("bash", "-c", fmt.Sprintf("git ls-remote --tags origin | grep -q \"refs/tags/%s\"", tag)); err != nil {
-		// `grep` returns an exit code of 1 if no match is found.
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-			return false, nil
-		}
-		return false, fmt.Errorf("could not check whether tag '%s' exists: %v", tag, err)
+	if len(pullRequests) == 0 {
+		return nil, nil
 	}
 
-	return true, nil
+	return pullRequests[0], nil
 }
 
-func AddOrMoveTag(tag string) error {
-	tagExists, err := TagExists(tag)
-	if err != nil {
-		return fmt.Errorf("could not add or move tag '%s': %v", tag, err)
-	}
+func CreatePullRequest(api GitHubAPI, owner string, name string, branch string, baseBranch string, title string, body string) (*gogithub.PullRequest, error) {
+	ctx := context.Background()
 
-	if !tagExists {
-		err = AddTag(tag)
-	} else {
-		err = MoveTag(tag)
-	}
+	log.Println("- Creating pull request...")
 
+	pullRequest, err := api.CreatePullRequest(ctx, owner, name, &gogithub.NewPullRequest{
+		Title:               gogithub.String(title),
+		Head:                gogithub.String(branch),
+		Base:                gogithub.String(baseBranch),
+		Body:                gogithub.String(body),
+		MaintainerCanModify: gogithub.Bool(true),
+	})
 	if err != nil {
-		return fmt.Errorf("could not add or move tag '%s': %v", tag, err)
+		return pullRequest, fmt.Errorf("could not create pull request from '%s' to '%s': %w", branch, baseBranch, err)
 	}
 
-	return nil
+	return pullRequest, nil
 }
 
-func locallySync(targetRepo string, targetRepoDir string, versionTag string) error {
-	if err := CloneRepository(targetRepo, targetRepoDir); err != nil {
-		return err
-	}
-
-	syncedFilePattern := regexp.MustCompile(`synced_.+\.y(a)?ml`)
-	isSyncedFile := func(info os.FileInfo) bool {
-		return syncedFilePattern.MatchString(info.Name())
-	}
-
-	replaceRef := func(contents string) string {
-		contents = strings.ReplaceAll(contents, "@main", fmt.Sprintf("@%s", versionTag))
-		return strings.ReplaceAll(contents, "go-file-ref: ''", fmt.Sprintf("go-file-ref: '%s'", versionTag))
-	}
-
-	targetWorkflowPath := targetRepoDir + "/.github/workflows"
-	sourceWorkflowPath := ".github/workflows"
-
-	if !PathExists(targetWorkflowPath) {
-		if err := CreateDirectory(targetWorkflowPath); err != nil {
-			return fmt.Errorf("could not create workflow path for target repo '%s': %w", targetRepo, err)
-		}
-	}
-
-	if err := DeleteSpecificFiles(targetWorkflowPath, isSyncedFile); err != nil {
-		return fmt.Errorf("could not delete synced workflow files from target repo '%s': %w", targetRepo, err)
-	}
+func UpdatePullRequest(api GitHubAPI, owner string, name string, pullRequest *gogithub.PullRequest, title string, body string) (*gogithub.PullRequest, error) {
+	ctx := context.Background()
 
-	if err := CopySpecificFiles(sourceWorkflowPath, targetWorkflowPath, isSyncedFile); err != nil {
-		return fmt.Errorf("could not copy synced workflow files to target repo '%s': %w", targetRepo, err)
-	}
+	log.Printf("- Updating pull request #%v...\n", *pullRequest.Number)
 
-	if err := ModifySpecificFiles(targetWorkflowPath, isSyncedFile, replaceRef); err != nil {
-		return fmt.Errorf("could not replace ref of workflows in target repo '%s': %v", targetRepo, err)
+	updatedPullRequest, err := api.EditPullRequest(ctx, owner, name, *pullRequest.Number, &gogithub.PullRequest{
+		Title: gogithub.String(title),
+		Body:  gogithub.String(body),
+	})
+	if err != nil {
+		return pullRequest, fmt.Errorf("could not update pull request #%v: %w", *pullRequest.Number, err)
 	}
 
-	return nil
-}
-
-func isOk(response *gogithub.Response) bool {
-	statusCodeString := fmt.Sprintf("%v", response.StatusCode)
-	return statusCodeString[0] != '4' && statusCodeString[0] != '5'
+	return updatedPullRequest, nil
 }
 
-func CreatePullRequest(owner string, name string, branch string, title string, workflowRun *gogithub.WorkflowRun) (*gogithub.PullRequest, error) {
+// GetMergeableState returns the mergeable state of a pull request, e.g. "clean" when it can be
+// merged and its checks passed. GitHub computes it in the background after every push, so
+// "unknown" states are polled a few times.
+func GetMergeableState(api GitHubAPI, owner string, name string, pullRequest *gogithub.PullRequest) (string, error) {
 	ctx := context.Background()
-	client := getClient()
 
-	log.Println("- Creating pull request...")
-
-	defaultBranch, err := GetDefaultBranch(owner, name)
-	if err != nil {
-		return nil, err
-	}
-
-	pullRequest, response, err := client.PullRequests.Create(ctx, owner, name, &gogithub.NewPullRequest{
-		Title:               gogithub.String(title),
-		Head:                gogithub.String(branch),
-		Base:                gogithub.String(defaultBranch),
-		Body:                gogithub.String(fmt.Sprintf("*Automatically generated from [workflow run **%s** #%v](%s) in [%s](%s).*", *workflowRun.Name, *workflowRun.RunNumber, *workflowRun.HTMLURL, *workflowRun.Repository.FullName, *workflowRun.Repository.HTMLURL)),
-		MaintainerCanModify: gogithub.Bool(true),
-	})
-	if err != nil || !isOk(response) {
-		format := "could not create pull request from '%s' to '%s': %v"
+	for attempt := 1; ; attempt++ {
+		currentPullRequest, err := api.GetPullRequest(ctx, owner, name, *pullRequest.Number)
 		if err != nil {
-			return pullRequest, fmt.Errorf(format, branch, defaultBranch, err)
+			return "", fmt.Errorf("could not get pull request #%v: %w", *pullRequest.Number, err)
 		}
-		return pullRequest, fmt.Errorf(format, branch, defaultBranch, response.Body)
-	}
 
-	return pullRequest, nil
+		mergeableState := currentPullRequest.GetMergeableState()
+		if mergeableState != MergeableStateUnknown || attempt == mergeableStateAttempts {
+			return mergeableState, nil
+		}
+
+		time.Sleep(mergeableStateInterval)
+	}
 }
 
-func ApprovePullRequest(owner string, name string, pullRequest *gogithub.PullRequest) error {
+func ApprovePullRequest(api GitHubAPI, owner string, name string, pullRequest *gogithub.PullRequest) error {
 	ctx := context.Background()
-	client := getApproverClient()
 
 	log.Println("- Approving pull request...")
 
-	_, response, err := client.PullRequests.CreateReview(ctx, owner, name, *pullRequest.Number, &gogithub.PullRequestReviewRequest{
-		Event: gogithub.String("APPROVE"),
-	})
-	if err != nil || !isOk(response) {
-		format := "could not approve pull request #%v: %v"
-		if err != nil {
-			return fmt.Errorf(format, *pullRequest.Number, err)
-		}
-		return fmt.Errorf(format, *pullRequest.Number, response.Body)
+	if err := api.ApprovePullRequest(ctx, owner, name, *pullRequest.Number); err != nil {
+		return fmt.Errorf("could not approve pull request #%v: %w", *pullRequest.Number, err)
 	}
 
 	return nil
 }
 
-func MergePullRequest(owner string, name string, pullRequest *gogithub.PullRequest) error {
+func MergePullRequest(api GitHubAPI, owner string, name string, pullRequest *gogithub.PullRequest, merge MergeConfig) error {
 	ctx := context.Background()
-	client := getClient()
 
 	log.Println("- Merging pull request...")
 
-	_, response, err := client.PullRequests.Merge(ctx, owner, name, *pullRequest.Number, "", &gogithub.PullRequestOptions{})
-	if err != nil || !isOk(response) {
-		format := "could not merge pull request #%v: %v"
-		if err != nil {
-			return fmt.Errorf(format, *pullRequest.Number, err)
-		}
-		return fmt.Errorf(format, *pullRequest.Number, response.Body)
+	// Pinning the head makes the merge fail if anything was pushed after the checks passed.
+	options := &gogithub.PullRequestOptions{MergeMethod: merge.Method, CommitTitle: merge.CommitTitle, SHA: pullRequest.GetHead().GetSHA()}
+	if err := api.MergePullRequest(ctx, owner, name, *pullRequest.Number, options); err != nil {
+		return fmt.Errorf("could not merge pull request #%v: %w", *pullRequest.Number, err)
 	}
 
 	return nil
 }
 
-func SyncRepository(targetRepo string, versionTag string) (*gogithub.PullRequest, error) {
-	targetOwner, targetName := RepoOwnerName(targetRepo)
-	targetRepoDir := targetName
-	if err := locallySync(targetRepo, targetRepoDir, versionTag); err != nil {
-		return nil, fmt.Errorf("could not sync locally: %w", err)
-	}
-
-	featureBranch := "sync-workflows"
-	changesPushed := false
-	err := ExecInDir(targetRepoDir, func() error {
-		SetupGitHubUser()
-		success, err := CreateAndPushToNewBranch(targetOwner, targetName, featureBranch)
-		changesPushed = success
-		if err != nil {
-			return fmt.Errorf("could not create and push to new branch '%s': %w", featureBranch, err)
-		}
+func EnableAutoMerge(api GitHubAPI, owner string, name string, pullRequest *gogithub.PullRequest, merge MergeConfig) error {
+	ctx := ContextWithOwner(context.Background(), owner)
 
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-	if !changesPushed {
-		// There were no changes, so we have nothing to make a pull request of.
-		return nil, nil
-	}
-
-	workflowRun, err := GetCurrentWorkflowRun()
-	if err != nil {
-		return nil, err
-	}
+	log.Println("- Enabling auto-merge for pull request...")
 
-	pullRequest, err := CreatePullRequest(targetOwner, targetName, featureBranch, "(sync): update workflows", workflowRun)
-	if err != nil {
-		return pullRequest, err
+	if err := api.EnablePullRequestAutoMerge(ctx, pullRequest.GetNodeID(), merge.Method, merge.CommitTitle); err != nil {
+		return fmt.Errorf("could not enable auto-merge for pull request '%s/%s#%v': %w", owner, name, *pullRequest.Number, err)
 	}
 
-	if err := ApprovePullRequest(targetOwner, targetName, pullRequest); err != nil {
-		return pullRequest, err
-	}
+	return nil
+}
 
-	if err := MergePullRequest(targetOwner, targetName, pullRequest); err != nil {
-		return pullRequest, err
-	}
+func EnqueuePullRequest(api GitHubAPI, owner string, name string, pullRequest *gogithub.PullRequest) error {
+	ctx := ContextWithOwner(context.Background(), owner)
 
-	err = ExecInDir(targetRepoDir, func() error {
-		SetupGitHubUser()
-		if err := DeleteBranch(targetOwner, targetName, featureBranch); err != nil {
-			return fmt.Errorf("could not delete merged '%s' branch: %w", featureBranch, err)
-		}
+	log.Println("- Adding pull request to the merge queue...")
 
-		return nil
-	})
-	if err != nil {
-		return pullRequest, err
+	if err := api.EnqueuePullRequest(ctx, pullRequest.GetNodeID()); err != nil {
+		return fmt.Errorf("could not add pull request '%s/%s#%v' to the merge queue: %w", owner, name, *pullRequest.Number, err)
 	}
 
-	return pullRequest, nil
+	return nil
 }
@@ -0,0 +1,216 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	gogithub "github.com/google/go-github/v62/github"
+)
+
+type GitHubAPI interface {
+	GetRepository(ctx context.Context, owner string, name string) (*gogithub.Repository, error)
+	GetBranch(ctx context.Context, owner string, name string, branch string) (*gogithub.Branch, error)
+	GetWorkflowRun(ctx context.Context, owner string, name string, runId int64) (*gogithub.WorkflowRun, error)
+	GetFileContents(ctx context.Context, owner string, name string, path string, ref string) (*gogithub.RepositoryContent, error)
+	GetTree(ctx context.Context, owner string, name string, ref string) (*gogithub.Tree, error)
+	PutFileContents(ctx context.Context, owner string, name string, path string, options *gogithub.RepositoryContentFileOptions) error
+	CreateBranch(ctx context.Context, owner string, name string, branch string, sha string) error
+	ListPullRequests(ctx context.Context, owner string, name string, options *gogithub.PullRequestListOptions) ([]*gogithub.PullRequest, error)
+	GetPullRequest(ctx context.Context, owner string, name string, number int) (*gogithub.PullRequest, error)
+	CreatePullRequest(ctx context.Context, owner string, name string, pullRequest *gogithub.NewPullRequest) (*gogithub.PullRequest, error)
+	EditPullRequest(ctx context.Context, owner string, name string, number int, pullRequest *gogithub.PullRequest) (*gogithub.PullRequest, error)
+	ApprovePullRequest(ctx context.Context, owner string, name string, number int) error
+	MergePullRequest(ctx context.Context, owner string, name string, number int, options *gogithub.PullRequestOptions) error
+	EnablePullRequestAutoMerge(ctx context.Context, pullRequestId string, method string, commitTitle string) error
+	EnqueuePullRequest(ctx context.Context, pullRequestId string) error
+	ListCheckRuns(ctx context.Context, owner string, name string, ref string) ([]*gogithub.CheckRun, error)
+	GetCombinedStatus(ctx context.Context, owner string, name string, ref string) (*gogithub.CombinedStatus, error)
+}
+
+type GitHubClient struct {
+	client *gogithub.Client
+}
+
+func NewGitHubClient(client *gogithub.Client) *GitHubClient {
+	return &GitHubClient{client: client}
+}
+
+func responseError(response *gogithub.Response, err error) error {
+	if err != nil {
+		return Redact(err)
+	}
+	if response != nil && !isOk(response) {
+		return &APIError{StatusCode: response.StatusCode, Status: response.Status}
+	}
+
+	return nil
+}
+
+func isOk(response *gogithub.Response) bool {
+	statusCodeString := fmt.Sprintf("%v", response.StatusCode)
+	return statusCodeString[0] != '4' && statusCodeString[0] != '5'
+}
+
+func isNotFound(response *gogithub.Response) bool {
+	return response != nil && response.StatusCode == http.StatusNotFound
+}
+
+func (api *GitHubClient) GetRepository(ctx context.Context, owner string, name string) (*gogithub.Repository, error) {
+	repository, response, err := api.client.Repositories.Get(ctx, owner, name)
+	return repository, responseError(response, err)
+}
+
+// GetFileContents returns nil when there is no file at path, including when path is a directory.
+func (api *GitHubClient) GetFileContents(ctx context.Context, owner string, name string, path string, ref string) (*gogithub.RepositoryContent, error) {
+	fileContents, _, response, err := api.client.Repositories.GetContents(ctx, owner, name, path, &gogithub.RepositoryContentGetOptions{Ref: ref})
+	if isNotFound(response) {
+		return nil, nil
+	}
+
+	return fileContents, responseError(response, err)
+}
+
+// GetTree lists every entry of the tree of ref, including those in subdirectories.
+func (api *GitHubClient) GetTree(ctx context.Context, owner string, name string, ref string) (*gogithub.Tree, error) {
+	tree, response, err := api.client.Git.GetTree(ctx, owner, name, ref, true)
+	return tree, responseError(response, err)
+}
+
+// PutFileContents creates the file, or updates it when options has the SHA of the current file.
+func (api *GitHubClient) PutFileContents(ctx context.Context, owner string, name string, path string, options *gogithub.RepositoryContentFileOptions) error {
+	_, response, err := api.client.Repositories.CreateFile(ctx, owner, name, path, options)
+	return responseError(response, err)
+}
+
+func (api *GitHubClient) CreateBranch(ctx context.Context, owner string, name string, branch string, sha string) error {
+	_, response, err := api.client.Git.CreateRef(ctx, owner, name, &gogithub.Reference{
+		Ref:    gogithub.String("refs/heads/" + branch),
+		Object: &gogithub.GitObject{SHA: gogithub.String(sha)},
+	})
+	return responseError(response, err)
+}
+
+func (api *GitHubClient) GetBranch(ctx context.Context, owner string, name string, branch string) (*gogithub.Branch, error) {
+	branchInfo, response, err := api.client.Repositories.GetBranch(ctx, owner, name, branch, 1)
+	if isNotFound(response) {
+		return nil, nil
+	}
+
+	return branchInfo, responseError(response, err)
+}
+
+func (api *GitHubClient) GetWorkflowRun(ctx context.Context, owner string, name string, runId int64) (*gogithub.WorkflowRun, error) {
+	workflowRun, response, err := api.client.Actions.GetWorkflowRunByID(ctx, owner, name, runId)
+	return workflowRun, responseError(response, err)
+}
+
+func (api *GitHubClient) ListPullRequests(ctx context.Context, owner string, name string, options *gogithub.PullRequestListOptions) ([]*gogithub.PullRequest, error) {
+	pullRequests, response, err := api.client.PullRequests.List(ctx, owner, name, options)
+	return pullRequests, responseError(response, err)
+}
+
+func (api *GitHubClient) GetPullRequest(ctx context.Context, owner string, name string, number int) (*gogithub.PullRequest, error) {
+	pullRequest, response, err := api.client.PullRequests.Get(ctx, owner, name, number)
+	return pullRequest, responseError(response, err)
+}
+
+func (api *GitHubClient) CreatePullRequest(ctx context.Context, owner string, name string, pullRequest *gogithub.NewPullRequest) (*gogithub.PullRequest, error) {
+	createdPullRequest, response, err := api.client.PullRequests.Create(ctx, owner, name, pullRequest)
+	return createdPullRequest, responseError(response, err)
+}
+
+func (api *GitHubClient) EditPullRequest(ctx context.Context, owner string, name string, number int, pullRequest *gogithub.PullRequest) (*gogithub.PullRequest, error) {
+	editedPullRequest, response, err := api.client.PullRequests.Edit(ctx, owner, name, number, pullRequest)
+	return editedPullRequest, responseError(response, err)
+}
+
+func (api *GitHubClient) ApprovePullRequest(ctx context.Context, owner string, name string, number int) error {
+	_, response, err := api.client.PullRequests.CreateReview(ctx, owner, name, number, &gogithub.PullRequestReviewRequest{
+		Event: gogithub.String("APPROVE"),
+	})
+	return responseError(response, err)
+}
+
+func (api *GitHubClient) MergePullRequest(ctx context.Context, owner string, name string, number int, options *gogithub.PullRequestOptions) error {
+	_, response, err := api.client.PullRequests.Merge(ctx, owner, name, number, "", options)
+	return responseError(response, err)
+}
+
+// Auto-merge and merge queues are only available through the GraphQL API.
+func (api *GitHubClient) graphql(ctx context.Context, query string, variables map[string]any) error {
+	// The GraphQL API of GitHub Enterprise Server is "/api/graphql" instead of "/api/v3/graphql".
+	graphqlUrl := "graphql"
+	if strings.HasSuffix(api.client.BaseURL.Path, "/api/v3/") {
+		graphqlUrl = "../graphql"
+	}
+
+	request, err := api.client.NewRequest("POST", graphqlUrl, map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+
+	var graphqlResponse struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	response, err := api.client.Do(ctx, request, &graphqlResponse)
+	if err := responseError(response, err); err != nil {
+		return err
+	}
+
+	if len(graphqlResponse.Errors) > 0 {
+		var messages []string
+		for _, graphqlError := range graphqlResponse.Errors {
+			messages = append(messages, graphqlError.Message)
+		}
+		return fmt.Errorf("%s", strings.Join(messages, "; "))
+	}
+
+	return nil
+}
+
+func (api *GitHubClient) EnablePullRequestAutoMerge(ctx context.Context, pullRequestId string, method string, commitTitle string) error {
+	input := map[string]any{"pullRequestId": pullRequestId}
+	if method != "" {
+		input["mergeMethod"] = strings.ToUpper(method)
+	}
+	if commitTitle != "" {
+		input["commitHeadline"] = commitTitle
+	}
+
+	return api.graphql(ctx, `mutation($input: EnablePullRequestAutoMergeInput!) {
+		enablePullRequestAutoMerge(input: $input) { clientMutationId }
+	}`, map[string]any{"input": input})
+}
+
+func (api *GitHubClient) EnqueuePullRequest(ctx context.Context, pullRequestId string) error {
+	return api.graphql(ctx, `mutation($input: EnqueuePullRequestInput!) {
+		enqueuePullRequest(input: $input) { clientMutationId }
+	}`, map[string]any{"input": map[string]any{"pullRequestId": pullRequestId}})
+}
+
+func (api *GitHubClient) ListCheckRuns(ctx context.Context, owner string, name string, ref string) ([]*gogithub.CheckRun, error) {
+	options := &gogithub.ListCheckRunsOptions{ListOptions: gogithub.ListOptions{PerPage: 100}}
+
+	var checkRuns []*gogithub.CheckRun
+	for {
+		results, response, err := api.client.Checks.ListCheckRunsForRef(ctx, owner, name, ref, options)
+		if err := responseError(response, err); err != nil {
+			return nil, err
+		}
+
+		checkRuns = append(checkRuns, results.CheckRuns...)
+		if response.NextPage == 0 {
+			return checkRuns, nil
+		}
+		options.Page = response.NextPage
+	}
+}
+
+func (api *GitHubClient) GetCombinedStatus(ctx context.Context, owner string, name string, ref string) (*gogithub.CombinedStatus, error) {
+	combinedStatus, response, err := api.client.Repositories.GetCombinedStatus(ctx, owner, name, ref, &gogithub.ListOptions{PerPage: 100})
+	return combinedStatus, responseError(response, err)
+}
@@ -0,0 +1,913 @@
+package githubfake
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	gogithub "github.com/google/go-github/v62/github"
+)
+
+// Server is a fake of the GitHub REST API for offline end-to-end tests. Repositories can be
+// backed by local bare git repositories, whose branches are then used for branch lookups and
+// merges, so a sync can push to them with a real `git` and merge its pull requests here.
+type Server struct {
+	*httptest.Server
+	mutex        sync.Mutex
+	repositories map[string]*Repository
+	workflowRuns map[int64]*gogithub.WorkflowRun
+}
+
+type Repository struct {
+	Owner         string
+	Name          string
+	DefaultBranch string
+	GitDir        string
+	Branches      map[string]string
+	PullRequests  []*PullRequest
+	CheckRuns     map[string][]*gogithub.CheckRun
+	Statuses      map[string][]*gogithub.RepoStatus
+}
+
+// PullRequest is a pull request of a Repository. Its MergeableState is reported as is, since
+// the fake does not know which checks are required.
+type PullRequest struct {
+	Number         int
+	Title          string
+	Body           string
+	Head           string
+	Base           string
+	State          string
+	Merged         bool
+	MergeMethod    string
+	MergeableState string
+	Reviews        []string
+	AutoMerge      *AutoMerge
+	Queued         bool
+}
+
+type AutoMerge struct {
+	Method      string
+	CommitTitle string
+}
+
+func NewServer() *Server {
+	server := &Server{
+		repositories: map[string]*Repository{},
+		workflowRuns: map[int64]*gogithub.WorkflowRun{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/{owner}/{name}", server.getRepository)
+	mux.HandleFunc("GET /repos/{owner}/{name}/branches/{branch...}", server.getBranch)
+	mux.HandleFunc("GET /repos/{owner}/{name}/contents/{path...}", server.getContents)
+	mux.HandleFunc("PUT /repos/{owner}/{name}/contents/{path...}", server.putContents)
+	mux.HandleFunc("POST /repos/{owner}/{name}/git/refs", server.createRef)
+	mux.HandleFunc("GET /repos/{owner}/{name}/git/trees/{ref...}", server.getTree)
+	mux.HandleFunc("GET /repos/{owner}/{name}/actions/runs/{id}", server.getWorkflowRun)
+	mux.HandleFunc("GET /repos/{owner}/{name}/commits/{ref}/check-runs", server.listCheckRuns)
+	mux.HandleFunc("GET /repos/{owner}/{name}/commits/{ref}/status", server.getCombinedStatus)
+	mux.HandleFunc("GET /repos/{owner}/{name}/pulls", server.listPullRequests)
+	mux.HandleFunc("POST /repos/{owner}/{name}/pulls", server.createPullRequest)
+	mux.HandleFunc("GET /repos/{owner}/{name}/pulls/{number}", server.getPullRequest)
+	mux.HandleFunc("PATCH /repos/{owner}/{name}/pulls/{number}", server.editPullRequest)
+	mux.HandleFunc("POST /repos/{owner}/{name}/pulls/{number}/reviews", server.createReview)
+	mux.HandleFunc("PUT /repos/{owner}/{name}/pulls/{number}/merge", server.mergePullRequest)
+	mux.HandleFunc("POST /graphql", server.graphql)
+
+	server.Server = httptest.NewServer(mux)
+	return server
+}
+
+func (server *Server) Client() *gogithub.Client {
+	client := gogithub.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	client.UploadURL, _ = url.Parse(server.URL + "/")
+
+	return client
+}
+
+// AddRepository registers a repository. With an empty gitDir, its branches are only tracked
+// in Branches (branch name to commit SHA), otherwise they are read from the bare repository.
+func (server *Server) AddRepository(owner string, name string, defaultBranch string, gitDir string) *Repository {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository := &Repository{
+		Owner:         owner,
+		Name:          name,
+		DefaultBranch: defaultBranch,
+		GitDir:        gitDir,
+		Branches:      map[string]string{},
+		CheckRuns:     map[string][]*gogithub.CheckRun{},
+		Statuses:      map[string][]*gogithub.RepoStatus{},
+	}
+	server.repositories[owner+"/"+name] = repository
+
+	return repository
+}
+
+func (server *Server) Repository(repo string) *Repository {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.repositories[repo]
+}
+
+// RemoteURL can be used as the remote of synced repositories, it points at their bare repository.
+func (server *Server) RemoteURL(repo string) string {
+	repository := server.Repository(repo)
+	if repository == nil {
+		return ""
+	}
+
+	return repository.GitDir
+}
+
+func (server *Server) AddWorkflowRun(repo string, id int64, name string, runNumber int) *gogithub.WorkflowRun {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	workflowRun := &gogithub.WorkflowRun{
+		ID:        gogithub.Int64(id),
+		Name:      gogithub.String(name),
+		RunNumber: gogithub.Int(runNumber),
+		HTMLURL:   gogithub.String(fmt.Sprintf("%s/%s/actions/runs/%v", server.URL, repo, id)),
+		Repository: &gogithub.Repository{
+			FullName: gogithub.String(repo),
+			HTMLURL:  gogithub.String(fmt.Sprintf("%s/%s", server.URL, repo)),
+		},
+	}
+	server.workflowRuns[id] = workflowRun
+
+	return workflowRun
+}
+
+// AddCheckRun reports a check run for ref, which is either a commit SHA or a branch. For a
+// branch, the check run applies to whatever commit the branch points at when it is requested.
+func (server *Server) AddCheckRun(repo string, ref string, name string, status string, conclusion string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository := server.repositories[repo]
+	checkRun := &gogithub.CheckRun{
+		ID:      gogithub.Int64(int64(len(repository.CheckRuns[ref]) + 1)),
+		Name:    gogithub.String(name),
+		Status:  gogithub.String(status),
+		HTMLURL: gogithub.String(fmt.Sprintf("%s/%s/runs/%s", server.URL, repo, name)),
+	}
+	if conclusion != "" {
+		checkRun.Conclusion = gogithub.String(conclusion)
+	}
+
+	repository.CheckRuns[ref] = append(repository.CheckRuns[ref], checkRun)
+}
+
+func (server *Server) AddStatus(repo string, ref string, context string, state string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository := server.repositories[repo]
+	repository.Statuses[ref] = append(repository.Statuses[ref], &gogithub.RepoStatus{
+		Context:   gogithub.String(context),
+		State:     gogithub.String(state),
+		TargetURL: gogithub.String(fmt.Sprintf("%s/%s/statuses/%s", server.URL, repo, context)),
+	})
+}
+
+func writeJson(writer http.ResponseWriter, status int, value any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
+
+func writeError(writer http.ResponseWriter, status int, message string) {
+	writeJson(writer, status, map[string]string{"message": message})
+}
+
+func (server *Server) repository(writer http.ResponseWriter, request *http.Request) *Repository {
+	repository, ok := server.repositories[request.PathValue("owner")+"/"+request.PathValue("name")]
+	if !ok {
+		writeError(writer, http.StatusNotFound, "Not Found")
+		return nil
+	}
+
+	return repository
+}
+
+func (server *Server) pullRequest(writer http.ResponseWriter, request *http.Request) (*Repository, *PullRequest) {
+	repository := server.repository(writer, request)
+	if repository == nil {
+		return nil, nil
+	}
+
+	number, err := strconv.Atoi(request.PathValue("number"))
+	if err != nil || number < 1 || number > len(repository.PullRequests) {
+		writeError(writer, http.StatusNotFound, "Not Found")
+		return nil, nil
+	}
+
+	return repository, repository.PullRequests[number-1]
+}
+
+func (repository *Repository) git(args ...string) (string, error) {
+	out, err := repository.gitOutput(args...)
+	return strings.TrimSpace(out), err
+}
+
+func (repository *Repository) gitOutput(args ...string) (string, error) {
+	return repository.gitCommand("", nil, args...)
+}
+
+func (repository *Repository) gitCommand(input string, env []string, args ...string) (string, error) {
+	command := exec.Command("git", append([]string{"--git-dir", repository.GitDir}, args...)...)
+	command.Stdin = strings.NewReader(input)
+	command.Env = append(append(os.Environ(),
+		"GIT_AUTHOR_NAME=github-fake", "GIT_AUTHOR_EMAIL=github-fake@example.com",
+		"GIT_COMMITTER_NAME=github-fake", "GIT_COMMITTER_EMAIL=github-fake@example.com",
+	), env...)
+
+	out, err := command.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return "", fmt.Errorf("%s", exitErr.Stderr)
+	}
+
+	return string(out), err
+}
+
+func (repository *Repository) branchSha(branch string) (string, bool) {
+	if repository.GitDir == "" {
+		sha, ok := repository.Branches[branch]
+		return sha, ok
+	}
+
+	sha, err := repository.git("rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	return sha, err == nil && sha != ""
+}
+
+// merge creates a merge commit, unless the base branch can be fast-forwarded. With "squash" and
+// "rebase" (which is only approximated here), the base branch gets a single commit instead.
+func (repository *Repository) merge(pullRequest *PullRequest, method string, commitTitle string) (string, error) {
+	headSha, ok := repository.branchSha(pullRequest.Head)
+	if !ok {
+		return "", fmt.Errorf("head branch '%s' does not exist", pullRequest.Head)
+	}
+	baseSha, ok := repository.branchSha(pullRequest.Base)
+	if !ok {
+		return "", fmt.Errorf("base branch '%s' does not exist", pullRequest.Base)
+	}
+
+	if repository.GitDir == "" {
+		repository.Branches[pullRequest.Base] = headSha
+		return headSha, nil
+	}
+
+	if commitTitle == "" {
+		commitTitle = fmt.Sprintf("Merge pull request #%v from %s", pullRequest.Number, pullRequest.Head)
+		if method == "squash" || method == "rebase" {
+			commitTitle = fmt.Sprintf("%s (#%v)", pullRequest.Title, pullRequest.Number)
+		}
+	}
+
+	mergedSha := headSha
+	_, err := repository.git("merge-base", "--is-ancestor", baseSha, headSha)
+	canFastForward := err == nil
+	if !canFastForward || method == "squash" || method == "rebase" {
+		tree, err := repository.git("merge-tree", "--write-tree", baseSha, headSha)
+		if err != nil {
+			return "", fmt.Errorf("pull request is not mergeable: %v", err)
+		}
+
+		parents := []string{"-p", baseSha, "-p", headSha}
+		if method == "squash" || method == "rebase" {
+			parents = []string{"-p", baseSha}
+		}
+
+		if mergedSha, err = repository.git(append(append([]string{"commit-tree", tree}, parents...), "-m", commitTitle)...); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := repository.git("update-ref", "refs/heads/"+pullRequest.Base, mergedSha); err != nil {
+		return "", err
+	}
+
+	return mergedSha, nil
+}
+
+// commitFile commits contents to filePath on top of branch, like editing a file on GitHub.
+func (repository *Repository) commitFile(branch string, filePath string, contents string, message string) (string, error) {
+	parentSha, ok := repository.branchSha(branch)
+	if !ok {
+		return "", fmt.Errorf("branch '%s' does not exist", branch)
+	}
+
+	indexFile, err := os.CreateTemp("", "github-fake-index-")
+	if err != nil {
+		return "", err
+	}
+	indexFile.Close()
+	os.Remove(indexFile.Name())
+	defer os.Remove(indexFile.Name())
+	indexEnv := []string{"GIT_INDEX_FILE=" + indexFile.Name()}
+
+	blobSha, err := repository.gitCommand(contents, nil, "hash-object", "-w", "--stdin")
+	if err != nil {
+		return "", err
+	}
+	if _, err := repository.gitCommand("", indexEnv, "read-tree", parentSha); err != nil {
+		return "", err
+	}
+	if _, err := repository.gitCommand("", indexEnv, "update-index", "--add", "--cacheinfo", "100644,"+strings.TrimSpace(blobSha)+","+filePath); err != nil {
+		return "", err
+	}
+	tree, err := repository.gitCommand("", indexEnv, "write-tree")
+	if err != nil {
+		return "", err
+	}
+
+	commitSha, err := repository.git("commit-tree", strings.TrimSpace(tree), "-p", parentSha, "-m", message)
+	if err != nil {
+		return "", err
+	}
+	if _, err := repository.git("update-ref", "refs/heads/"+branch, commitSha); err != nil {
+		return "", err
+	}
+
+	return commitSha, nil
+}
+
+func (repository *Repository) refMatches(ref string, key string) bool {
+	if key == ref {
+		return true
+	}
+
+	sha, ok := repository.branchSha(key)
+	return ok && sha == ref
+}
+
+func (server *Server) toGitHub(repository *Repository, pullRequest *PullRequest) *gogithub.PullRequest {
+	repo := repository.Owner + "/" + repository.Name
+	headSha, _ := repository.branchSha(pullRequest.Head)
+	return &gogithub.PullRequest{
+		Number:         gogithub.Int(pullRequest.Number),
+		NodeID:         gogithub.String(fmt.Sprintf("PR_%s_%v", repo, pullRequest.Number)),
+		Title:          gogithub.String(pullRequest.Title),
+		Body:           gogithub.String(pullRequest.Body),
+		State:          gogithub.String(pullRequest.State),
+		Merged:         gogithub.Bool(pullRequest.Merged),
+		MergeableState: gogithub.String(pullRequest.MergeableState),
+		HTMLURL:        gogithub.String(fmt.Sprintf("%s/%s/pull/%v", server.URL, repo, pullRequest.Number)),
+		Head:           &gogithub.PullRequestBranch{Ref: gogithub.String(pullRequest.Head), SHA: gogithub.String(headSha)},
+		Base:           &gogithub.PullRequestBranch{Ref: gogithub.String(pullRequest.Base)},
+	}
+}
+
+func (server *Server) getRepository(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository := server.repository(writer, request)
+	if repository == nil {
+		return
+	}
+
+	repo := repository.Owner + "/" + repository.Name
+	writeJson(writer, http.StatusOK, &gogithub.Repository{
+		Name:          gogithub.String(repository.Name),
+		FullName:      gogithub.String(repo),
+		Owner:         &gogithub.User{Login: gogithub.String(repository.Owner)},
+		DefaultBranch: gogithub.String(repository.DefaultBranch),
+		HTMLURL:       gogithub.String(fmt.Sprintf("%s/%s", server.URL, repo)),
+	})
+}
+
+func (server *Server) getBranch(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository := server.repository(writer, request)
+	if repository == nil {
+		return
+	}
+
+	branch := request.PathValue("branch")
+	sha, ok := repository.branchSha(branch)
+	if !ok {
+		writeError(writer, http.StatusNotFound, "Branch not found")
+		return
+	}
+
+	writeJson(writer, http.StatusOK, &gogithub.Branch{
+		Name:   gogithub.String(branch),
+		Commit: &gogithub.RepositoryCommit{SHA: gogithub.String(sha)},
+	})
+}
+
+// getContents only supports files, which are read from the git repository.
+func (server *Server) getContents(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository := server.repository(writer, request)
+	if repository == nil {
+		return
+	}
+
+	ref := request.URL.Query().Get("ref")
+	if ref == "" {
+		ref = repository.DefaultBranch
+	}
+
+	filePath := request.PathValue("path")
+	if repository.GitDir == "" {
+		writeError(writer, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	objectType, err := repository.git("cat-file", "-t", ref+":"+filePath)
+	if err != nil || objectType != "blob" {
+		writeError(writer, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	contents, err := repository.gitOutput("cat-file", "blob", ref+":"+filePath)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sha, _ := repository.git("rev-parse", ref+":"+filePath)
+
+	writeJson(writer, http.StatusOK, &gogithub.RepositoryContent{
+		Type:     gogithub.String("file"),
+		Name:     gogithub.String(path.Base(filePath)),
+		Path:     gogithub.String(filePath),
+		SHA:      gogithub.String(sha),
+		Encoding: gogithub.String("base64"),
+		Content:  gogithub.String(base64.StdEncoding.EncodeToString([]byte(contents))),
+	})
+}
+
+// getTree reads the tree of a ref from the git repository, with "recursive" like `ls-tree -r`.
+func (server *Server) getTree(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository := server.repository(writer, request)
+	if repository == nil {
+		return
+	}
+
+	if repository.GitDir == "" {
+		writeError(writer, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	ref := request.PathValue("ref")
+	args := []string{"ls-tree", "-z", "--full-tree"}
+	if request.URL.Query().Get("recursive") != "" {
+		args = append(args, "-r")
+	}
+	out, err := repository.gitOutput(append(args, ref)...)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	tree := &gogithub.Tree{SHA: gogithub.String(ref), Truncated: gogithub.Bool(false)}
+	for _, entry := range strings.Split(out, "\x00") {
+		// Every entry is "<mode> <type> <sha>\t<path>".
+		info, entryPath, found := strings.Cut(entry, "\t")
+		modeTypeSha := strings.Fields(info)
+		if !found || len(modeTypeSha) != 3 {
+			continue
+		}
+
+		tree.Entries = append(tree.Entries, &gogithub.TreeEntry{
+			Mode: gogithub.String(modeTypeSha[0]),
+			Type: gogithub.String(modeTypeSha[1]),
+			SHA:  gogithub.String(modeTypeSha[2]),
+			Path: gogithub.String(entryPath),
+		})
+	}
+
+	writeJson(writer, http.StatusOK, tree)
+}
+
+func (server *Server) putContents(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository := server.repository(writer, request)
+	if repository == nil {
+		return
+	}
+	if repository.GitDir == "" {
+		writeError(writer, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	var options gogithub.RepositoryContentFileOptions
+	if err := json.NewDecoder(request.Body).Decode(&options); err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	branch := options.GetBranch()
+	if branch == "" {
+		branch = repository.DefaultBranch
+	}
+
+	filePath := request.PathValue("path")
+	existingSha, err := repository.git("rev-parse", "--verify", "--quiet", "refs/heads/"+branch+":"+filePath)
+	if err == nil && existingSha != options.GetSHA() {
+		writeError(writer, http.StatusConflict, fmt.Sprintf("%s does not match %s", filePath, options.GetSHA()))
+		return
+	}
+
+	commitSha, err := repository.commitFile(branch, filePath, string(options.Content), options.GetMessage())
+	if err != nil {
+		writeError(writer, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	writeJson(writer, http.StatusOK, &gogithub.RepositoryContentResponse{
+		Content: &gogithub.RepositoryContent{Path: gogithub.String(filePath)},
+		Commit:  gogithub.Commit{SHA: gogithub.String(commitSha)},
+	})
+}
+
+func (server *Server) createRef(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository := server.repository(writer, request)
+	if repository == nil {
+		return
+	}
+	if repository.GitDir == "" {
+		writeError(writer, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	var reference struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&reference); err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := repository.git("rev-parse", "--verify", "--quiet", reference.Ref); err == nil {
+		writeError(writer, http.StatusUnprocessableEntity, "Reference already exists")
+		return
+	}
+	if _, err := repository.git("update-ref", reference.Ref, reference.SHA); err != nil {
+		writeError(writer, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	writeJson(writer, http.StatusCreated, &gogithub.Reference{
+		Ref:    gogithub.String(reference.Ref),
+		Object: &gogithub.GitObject{SHA: gogithub.String(reference.SHA)},
+	})
+}
+
+func (server *Server) getWorkflowRun(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	id, _ := strconv.ParseInt(request.PathValue("id"), 10, 64)
+	workflowRun, ok := server.workflowRuns[id]
+	if !ok {
+		writeError(writer, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	writeJson(writer, http.StatusOK, workflowRun)
+}
+
+func (server *Server) listCheckRuns(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository := server.repository(writer, request)
+	if repository == nil {
+		return
+	}
+
+	checkRuns := []*gogithub.CheckRun{}
+	for _, key := range sortedKeys(repository.CheckRuns) {
+		if repository.refMatches(request.PathValue("ref"), key) {
+			checkRuns = append(checkRuns, repository.CheckRuns[key]...)
+		}
+	}
+
+	writeJson(writer, http.StatusOK, &gogithub.ListCheckRunsResults{
+		Total:     gogithub.Int(len(checkRuns)),
+		CheckRuns: checkRuns,
+	})
+}
+
+func (server *Server) getCombinedStatus(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository := server.repository(writer, request)
+	if repository == nil {
+		return
+	}
+
+	// Like GitHub, only the latest status of every context counts.
+	latestStatuses := map[string]*gogithub.RepoStatus{}
+	for _, key := range sortedKeys(repository.Statuses) {
+		if repository.refMatches(request.PathValue("ref"), key) {
+			for _, status := range repository.Statuses[key] {
+				latestStatuses[status.GetContext()] = status
+			}
+		}
+	}
+
+	statuses := []*gogithub.RepoStatus{}
+	states := map[string]bool{}
+	for _, context := range sortedKeys(latestStatuses) {
+		statuses = append(statuses, latestStatuses[context])
+		states[latestStatuses[context].GetState()] = true
+	}
+
+	state := "success"
+	if states["failure"] || states["error"] {
+		state = "failure"
+	} else if states["pending"] || len(statuses) == 0 {
+		state = "pending"
+	}
+
+	writeJson(writer, http.StatusOK, &gogithub.CombinedStatus{
+		State:      gogithub.String(state),
+		TotalCount: gogithub.Int(len(statuses)),
+		Statuses:   statuses,
+	})
+}
+
+func (server *Server) listPullRequests(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository := server.repository(writer, request)
+	if repository == nil {
+		return
+	}
+
+	// Like GitHub, "head" is filtered as "owner:branch" and "state" defaults to "open".
+	query := request.URL.Query()
+	state := query.Get("state")
+	if state == "" {
+		state = "open"
+	}
+
+	pullRequests := []*gogithub.PullRequest{}
+	for _, pullRequest := range repository.PullRequests {
+		if state != "all" && pullRequest.State != state {
+			continue
+		}
+		if head := query.Get("head"); head != "" && head != repository.Owner+":"+pullRequest.Head {
+			continue
+		}
+		if base := query.Get("base"); base != "" && base != pullRequest.Base {
+			continue
+		}
+
+		pullRequests = append(pullRequests, server.toGitHub(repository, pullRequest))
+	}
+
+	writeJson(writer, http.StatusOK, pullRequests)
+}
+
+func (server *Server) createPullRequest(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository := server.repository(writer, request)
+	if repository == nil {
+		return
+	}
+
+	var newPullRequest gogithub.NewPullRequest
+	if err := json.NewDecoder(request.Body).Decode(&newPullRequest); err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, ok := repository.branchSha(newPullRequest.GetHead()); !ok {
+		writeError(writer, http.StatusUnprocessableEntity, "Validation Failed: head does not exist")
+		return
+	}
+	if _, ok := repository.branchSha(newPullRequest.GetBase()); !ok {
+		writeError(writer, http.StatusUnprocessableEntity, "Validation Failed: base does not exist")
+		return
+	}
+
+	for _, existing := range repository.PullRequests {
+		if existing.State == "open" && existing.Head == newPullRequest.GetHead() && existing.Base == newPullRequest.GetBase() {
+			writeError(writer, http.StatusUnprocessableEntity, "Validation Failed: a pull request already exists")
+			return
+		}
+	}
+
+	pullRequest := &PullRequest{
+		Number: len(repository.PullRequests) + 1,
+		Title:  newPullRequest.GetTitle(),
+		Body:   newPullRequest.GetBody(),
+		Head:   newPullRequest.GetHead(),
+		Base:   newPullRequest.GetBase(),
+		State:  "open",
+	}
+	repository.PullRequests = append(repository.PullRequests, pullRequest)
+
+	writeJson(writer, http.StatusCreated, server.toGitHub(repository, pullRequest))
+}
+
+func (server *Server) getPullRequest(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository, pullRequest := server.pullRequest(writer, request)
+	if pullRequest == nil {
+		return
+	}
+
+	writeJson(writer, http.StatusOK, server.toGitHub(repository, pullRequest))
+}
+
+func (server *Server) editPullRequest(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository, pullRequest := server.pullRequest(writer, request)
+	if pullRequest == nil {
+		return
+	}
+
+	var edit gogithub.PullRequest
+	if err := json.NewDecoder(request.Body).Decode(&edit); err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if edit.Title != nil {
+		pullRequest.Title = edit.GetTitle()
+	}
+	if edit.Body != nil {
+		pullRequest.Body = edit.GetBody()
+	}
+	if edit.State != nil && !pullRequest.Merged {
+		pullRequest.State = edit.GetState()
+	}
+
+	writeJson(writer, http.StatusOK, server.toGitHub(repository, pullRequest))
+}
+
+func (server *Server) createReview(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	_, pullRequest := server.pullRequest(writer, request)
+	if pullRequest == nil {
+		return
+	}
+
+	var review gogithub.PullRequestReviewRequest
+	if err := json.NewDecoder(request.Body).Decode(&review); err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pullRequest.Reviews = append(pullRequest.Reviews, review.GetEvent())
+
+	writeJson(writer, http.StatusOK, &gogithub.PullRequestReview{
+		ID:    gogithub.Int64(int64(len(pullRequest.Reviews))),
+		State: gogithub.String(review.GetEvent()),
+	})
+}
+
+func (server *Server) mergePullRequest(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	repository, pullRequest := server.pullRequest(writer, request)
+	if pullRequest == nil {
+		return
+	}
+
+	if pullRequest.State != "open" {
+		writeError(writer, http.StatusMethodNotAllowed, "Pull Request is not open")
+		return
+	}
+
+	var mergeRequest struct {
+		CommitTitle string `json:"commit_title"`
+		SHA         string `json:"sha"`
+		MergeMethod string `json:"merge_method"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&mergeRequest); err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if headSha, _ := repository.branchSha(pullRequest.Head); mergeRequest.SHA != "" && mergeRequest.SHA != headSha {
+		writeError(writer, http.StatusConflict, "Head branch was modified. Review and try the merge again.")
+		return
+	}
+
+	sha, err := repository.merge(pullRequest, mergeRequest.MergeMethod, mergeRequest.CommitTitle)
+	if err != nil {
+		writeError(writer, http.StatusMethodNotAllowed, err.Error())
+		return
+	}
+
+	pullRequest.State = "closed"
+	pullRequest.Merged = true
+	pullRequest.MergeMethod = mergeRequest.MergeMethod
+
+	writeJson(writer, http.StatusOK, &gogithub.PullRequestMergeResult{
+		SHA:     gogithub.String(sha),
+		Merged:  gogithub.Bool(true),
+		Message: gogithub.String("Pull Request successfully merged"),
+	})
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// graphql only supports the mutations that leave merging sync pull requests to GitHub.
+func (server *Server) graphql(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	var graphqlRequest struct {
+		Query     string `json:"query"`
+		Variables struct {
+			Input struct {
+				PullRequestId  string `json:"pullRequestId"`
+				MergeMethod    string `json:"mergeMethod"`
+				CommitHeadline string `json:"commitHeadline"`
+			} `json:"input"`
+		} `json:"variables"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&graphqlRequest); err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	input := graphqlRequest.Variables.Input
+	var pullRequest *PullRequest
+	for _, repository := range server.repositories {
+		for _, candidate := range repository.PullRequests {
+			if server.toGitHub(repository, candidate).GetNodeID() == input.PullRequestId {
+				pullRequest = candidate
+			}
+		}
+	}
+
+	writeGraphqlError := func(message string) {
+		writeJson(writer, http.StatusOK, map[string]any{"errors": []map[string]string{{"message": message}}})
+	}
+	if pullRequest == nil {
+		writeGraphqlError(fmt.Sprintf("Could not resolve to a node with the global id of '%s'", input.PullRequestId))
+		return
+	} else if pullRequest.State != "open" {
+		writeGraphqlError("Pull request is not open")
+		return
+	}
+
+	switch {
+	case strings.Contains(graphqlRequest.Query, "enablePullRequestAutoMerge") && pullRequest.MergeableState == "clean":
+		writeGraphqlError("Pull request Pull request is in clean status")
+	case strings.Contains(graphqlRequest.Query, "enablePullRequestAutoMerge"):
+		pullRequest.AutoMerge = &AutoMerge{Method: strings.ToLower(input.MergeMethod), CommitTitle: input.CommitHeadline}
+		writeJson(writer, http.StatusOK, map[string]any{"data": map[string]any{"enablePullRequestAutoMerge": map[string]any{}}})
+	case strings.Contains(graphqlRequest.Query, "enqueuePullRequest"):
+		pullRequest.Queued = true
+		writeJson(writer, http.StatusOK, map[string]any{"data": map[string]any{"enqueuePullRequest": map[string]any{}}})
+	default:
+		writeGraphqlError("Unsupported query")
+	}
+}
@@ -0,0 +1,160 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+const LockPath = ".github/sync.lock"
+
+const LockVersion = 1
+
+// SyncLock records what a target repository received from the last sync, so that hand edits to
+// managed files can be found. Files that are only created once belong to the repository after
+// that, so they are not locked.
+type SyncLock struct {
+	Version int          `json:"version"`
+	Source  string       `json:"source"`
+	Tag     string       `json:"tag"`
+	Commit  string       `json:"commit,omitempty"`
+	Files   []LockedFile `json:"files"`
+}
+
+// LockedFile is the hash of a managed file, or only of its managed block when it has Markers.
+type LockedFile struct {
+	Path      string        `json:"path"`
+	Ownership string        `json:"ownership"`
+	SHA256    string        `json:"sha256"`
+	Markers   *BlockMarkers `json:"markers,omitempty"`
+}
+
+type LockViolation struct {
+	Path    string
+	Problem string
+}
+
+func hashContents(contents string) string {
+	hash := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(hash[:])
+}
+
+func NewSyncLock(source string, versionTag string, commit string, managedFiles []ManagedFile) SyncLock {
+	lock := SyncLock{
+		Version: LockVersion,
+		Source:  source,
+		Tag:     versionTag,
+		Commit:  commit,
+		Files:   []LockedFile{},
+	}
+
+	for _, managedFile := range managedFiles {
+		lockedFile := LockedFile{
+			Path:      managedFile.Path,
+			Ownership: managedFile.Ownership,
+			SHA256:    hashContents(managedFile.Contents),
+		}
+
+		switch managedFile.Ownership {
+		case OwnershipCreate:
+			continue
+		case OwnershipBlock:
+			markers := managedFile.Markers
+			lockedFile.Markers = &markers
+			lockedFile.SHA256 = hashContents(normalizeBlock(managedFile.Contents))
+		}
+
+		lock.Files = append(lock.Files, lockedFile)
+	}
+
+	sort.Slice(lock.Files, func(i, j int) bool {
+		return lock.Files[i].Path < lock.Files[j].Path
+	})
+
+	return lock
+}
+
+// IsEquivalent tells whether a target received the same files from the same release and commit
+// of the source.
+func (lock SyncLock) IsEquivalent(other SyncLock) bool {
+	return reflect.DeepEqual(lock, other)
+}
+
+func ParseSyncLock(contents string) (SyncLock, error) {
+	var lock SyncLock
+	if err := json.Unmarshal([]byte(contents), &lock); err != nil {
+		return SyncLock{}, fmt.Errorf("could not parse lockfile: %w", err)
+	}
+	if lock.Version != LockVersion {
+		return SyncLock{}, fmt.Errorf("unsupported lockfile version %v, expected %v", lock.Version, LockVersion)
+	}
+
+	return lock, nil
+}
+
+func LoadSyncLock(path string) (SyncLock, error) {
+	contents, err := ReadFile(path)
+	if err != nil {
+		return SyncLock{}, fmt.Errorf("could not read lockfile '%s': %w", path, err)
+	}
+
+	return ParseSyncLock(contents)
+}
+
+func WriteSyncLock(path string, lock SyncLock) error {
+	lockJson, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not convert lockfile to JSON: %w", err)
+	}
+
+	if err := WriteFile(path, string(lockJson)+"\n"); err != nil {
+		return fmt.Errorf("could not write lockfile to '%s': %w", path, err)
+	}
+
+	return nil
+}
+
+// VerifySyncLock compares the files in dir with the hashes in the lockfile, and returns every
+// managed file that was edited or removed since the last sync.
+func VerifySyncLock(dir string, lock SyncLock) []LockViolation {
+	var violations []LockViolation
+	for _, lockedFile := range lock.Files {
+		filePath := filepath.Join(dir, lockedFile.Path)
+		if !PathExists(filePath) {
+			violations = append(violations, LockViolation{Path: lockedFile.Path, Problem: "missing"})
+			continue
+		}
+
+		contents, err := ReadFile(filePath)
+		if err != nil {
+			violations = append(violations, LockViolation{Path: lockedFile.Path, Problem: fmt.Sprintf("could not be read: %v", err)})
+			continue
+		}
+
+		if lockedFile.Markers != nil {
+			block, found, err := readManagedBlock(contents, *lockedFile.Markers)
+			if err != nil {
+				violations = append(violations, LockViolation{Path: lockedFile.Path, Problem: err.Error()})
+				continue
+			} else if !found {
+				violations = append(violations, LockViolation{Path: lockedFile.Path, Problem: "managed block is missing"})
+				continue
+			}
+			contents = block
+		}
+
+		if hashContents(contents) != lockedFile.SHA256 {
+			problem := "modified"
+			if lockedFile.Markers != nil {
+				problem = "managed block was modified"
+			}
+			violations = append(violations, LockViolation{Path: lockedFile.Path, Problem: problem})
+		}
+	}
+
+	return violations
+}
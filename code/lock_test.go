@@ -0,0 +1,149 @@
+package common
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var lockedManagedFiles = []ManagedFile{
+	{Path: ".github/workflows/synced_build.yaml", Contents: "name: Build\n", Ownership: OwnershipReplace},
+	{Path: ".github/CODEOWNERS", Contents: "* @org/team\n", Ownership: OwnershipCreate},
+	{Path: ".gitignore", Contents: "dist/", Ownership: OwnershipBlock, Markers: NewBlockMarkers("#", "org/common")},
+}
+
+func TestNewSyncLock(t *testing.T) {
+	lock := NewSyncLock("org/common", "v1.4.2", "abc123", lockedManagedFiles)
+
+	if lock.Tag != "v1.4.2" || lock.Commit != "abc123" || lock.Source != "org/common" {
+		t.Errorf("NewSyncLock() recorded source '%s' at '%s' (%s)", lock.Source, lock.Tag, lock.Commit)
+	}
+
+	// Files that are only created once are not locked, and the rest is sorted by path.
+	if len(lock.Files) != 2 || lock.Files[0].Path != ".github/workflows/synced_build.yaml" || lock.Files[1].Path != ".gitignore" {
+		t.Fatalf("NewSyncLock() locked %+v", lock.Files)
+	}
+	if lock.Files[1].Markers == nil || lock.Files[1].SHA256 != hashContents("dist/\n") {
+		t.Errorf("NewSyncLock() did not lock the managed block of '.gitignore': %+v", lock.Files[1])
+	}
+}
+
+func TestSyncLockIsEquivalent(t *testing.T) {
+	lock := NewSyncLock("org/common", "v1.4.2", "abc123", lockedManagedFiles)
+
+	tests := []struct {
+		name       string
+		other      SyncLock
+		equivalent bool
+	}{
+		{"same release", NewSyncLock("org/common", "v1.4.2", "abc123", lockedManagedFiles), true},
+		{"other commit", NewSyncLock("org/common", "v1.4.2", "def456", lockedManagedFiles), false},
+		{"other release", NewSyncLock("org/common", "v1.4.3", "abc123", lockedManagedFiles), false},
+		{"other files", NewSyncLock("org/common", "v1.4.2", "abc123", lockedManagedFiles[:1]), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if equivalent := lock.IsEquivalent(test.other); equivalent != test.equivalent {
+				t.Errorf("IsEquivalent() returned %v, expected %v", equivalent, test.equivalent)
+			}
+		})
+	}
+}
+
+func TestParseSyncLock(t *testing.T) {
+	lock := NewSyncLock("org/common", "v1.4.2", "abc123", lockedManagedFiles)
+	lockPath := filepath.Join(t.TempDir(), "sync.lock")
+	if err := WriteSyncLock(lockPath, lock); err != nil {
+		t.Fatalf("WriteSyncLock() returned an error: %v", err)
+	}
+
+	loaded, err := LoadSyncLock(lockPath)
+	if err != nil || !loaded.IsEquivalent(lock) {
+		t.Errorf("LoadSyncLock() returned %+v (%v), expected the written lockfile", loaded, err)
+	}
+
+	if _, err := ParseSyncLock(`{"version": 2, "files": []}`); err == nil || !strings.Contains(err.Error(), "unsupported lockfile version 2") {
+		t.Errorf("ParseSyncLock() of a newer lockfile returned %v", err)
+	}
+	if _, err := ParseSyncLock(`{"version": `); err == nil {
+		t.Errorf("ParseSyncLock() of invalid JSON did not return an error")
+	}
+}
+
+func TestVerifySyncLock(t *testing.T) {
+	lock := NewSyncLock("org/common", "v1.4.2", "abc123", lockedManagedFiles)
+
+	tests := []struct {
+		name       string
+		files      map[string]string
+		violations []string
+	}{
+		{
+			name: "unchanged",
+			files: map[string]string{
+				".github/workflows/synced_build.yaml": "name: Build\n",
+				".gitignore":                          "node_modules/\n\n# BEGIN synced: org/common\r\ndist/\r\n# END synced\r\n",
+			},
+		},
+		{
+			name: "edited",
+			files: map[string]string{
+				".github/workflows/synced_build.yaml": "name: Build and Test\n",
+				".gitignore":                          "# BEGIN synced: org/common\ndist/\nbuild/\n# END synced\n",
+			},
+			violations: []string{".github/workflows/synced_build.yaml: modified", ".gitignore: managed block was modified"},
+		},
+		{
+			name: "removed",
+			files: map[string]string{
+				".gitignore": "dist/\n",
+			},
+			violations: []string{".github/workflows/synced_build.yaml: missing", ".gitignore: managed block is missing"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, test.files)
+
+			var violations []string
+			for _, violation := range VerifySyncLock(dir, lock) {
+				violations = append(violations, violation.Path+": "+violation.Problem)
+			}
+			if strings.Join(violations, "\n") != strings.Join(test.violations, "\n") {
+				t.Errorf("VerifySyncLock() returned %q, expected %q", violations, test.violations)
+			}
+		})
+	}
+}
+
+func TestSyncerReleaseTag(t *testing.T) {
+	syncer := &Syncer{SourceCommits: map[string]string{
+		"v1":      "aaa",
+		"v1.3":    "aaa",
+		"v1.3.0":  "aaa",
+		"v1.3.1":  "aaa",
+		"v1.2.0":  "bbb",
+		"v2":      "ccc",
+		"v11.0.0": "aaa",
+	}}
+
+	tests := []struct {
+		versionTag string
+		expected   string
+	}{
+		{"v1", "v1.3.1"},
+		{"v1.3", "v1.3.1"},
+		{"v1.2.0", "v1.2.0"},
+		{"v2", "v2"},
+		{"v3", "v3"},
+	}
+
+	for _, test := range tests {
+		if release := syncer.releaseTag(test.versionTag); release != test.expected {
+			t.Errorf("releaseTag(%q) = %q, expected %q", test.versionTag, release, test.expected)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const ManifestPath = "sync.yaml"
+
+const ManifestVersion = 1
+
+const DefaultSyncBranch = "sync-workflows"
+
+const DefaultChecksTimeout = "30m"
+
+const DefaultChecksInterval = "15s"
+
+const DefaultChecksGrace = "2m"
+
+const (
+	MergeModeDirect = "direct"
+	MergeModeAuto   = "auto"
+	MergeModeQueue  = "queue"
+	// MergeModeNone only opens or updates the sync pull request, without approving or merging it,
+	// e.g. to fix drift. It cannot be set in the manifest.
+	MergeModeNone = "none"
+)
+
+var MergeModes = []string{MergeModeDirect, MergeModeAuto, MergeModeQueue}
+
+var MergeMethods = []string{"merge", "squash", "rebase"}
+
+var DefaultFileSets = []FileSet{
+	{
+		Source:      ".github/workflows/synced_*.{yaml,yml}",
+		Destination: ".github/workflows",
+		Ownership:   OwnershipReplace,
+	},
+}
+
+// FileSet syncs the files matching the Source glob (e.g. ".github/ISSUE_TEMPLATE/**") to the
+// Destination directory, or a single Source file to the Destination path. Without a destination,
+// files end up at the same path as in the source repository. With "block" ownership, only a
+// managed block inside the destination is synced, delimited by markers in the Comment syntax.
+type FileSet struct {
+	Source      string `yaml:"source"`
+	Destination string `yaml:"destination"`
+	Ownership   string `yaml:"ownership"`
+	Comment     string `yaml:"comment"`
+}
+
+// ChecksConfig gates merging sync pull requests on the checks of their head commit. Without
+// any required checks, every check that is reported has to pass, and the checks count as pending
+// until one is reported or the Grace period passes, since CI may not have started yet.
+type ChecksConfig struct {
+	Enabled  *bool    `yaml:"enabled"`
+	Required []string `yaml:"required"`
+	Timeout  string   `yaml:"timeout"`
+	Interval string   `yaml:"interval"`
+	Grace    string   `yaml:"grace"`
+}
+
+// MergeConfig decides how sync pull requests are merged. Without a method, the default merge
+// method of the repository is used. The "auto" and "queue" modes leave merging to GitHub, by
+// enabling auto-merge or adding the pull request to the merge queue.
+type MergeConfig struct {
+	Mode        string `yaml:"mode"`
+	Method      string `yaml:"method"`
+	CommitTitle string `yaml:"commitTitle"`
+	Approve     *bool  `yaml:"approve"`
+}
+
+type SyncTarget struct {
+	Repository string            `yaml:"repository"`
+	Enabled    *bool             `yaml:"enabled"`
+	BaseBranch string            `yaml:"baseBranch"`
+	Branch     string            `yaml:"branch"`
+	Version    string            `yaml:"version"`
+	Files      []FileSet         `yaml:"files"`
+	Variables  map[string]string `yaml:"variables"`
+	Checks     ChecksConfig      `yaml:"checks"`
+	Merge      MergeConfig       `yaml:"merge"`
+}
+
+type Manifest struct {
+	Version      int          `yaml:"version"`
+	Defaults     SyncTarget   `yaml:"defaults"`
+	Repositories []SyncTarget `yaml:"repositories"`
+}
+
+func (target SyncTarget) IsEnabled() bool {
+	return target.Enabled == nil || *target.Enabled
+}
+
+func (config ChecksConfig) IsEnabled() bool {
+	return config.Enabled == nil || *config.Enabled
+}
+
+func (config ChecksConfig) TimeoutDuration() time.Duration {
+	timeout, _ := time.ParseDuration(config.Timeout)
+	return timeout
+}
+
+func (config ChecksConfig) IntervalDuration() time.Duration {
+	interval, _ := time.ParseDuration(config.Interval)
+	return interval
+}
+
+func (config ChecksConfig) GraceDuration() time.Duration {
+	grace, _ := time.ParseDuration(config.Grace)
+	return grace
+}
+
+func (config MergeConfig) ShouldApprove() bool {
+	return config.Approve == nil || *config.Approve
+}
+
+// IsSynced tells whether a file of the source repository is synced to the repository.
+func (target SyncTarget) IsSynced(filePath string) bool {
+	for _, fileSet := range target.Files {
+		if fileSet.MatchesSource(filePath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Target returns the resolved target for repository, or nil if it is not in the manifest.
+func (manifest *Manifest) Target(repository string) *SyncTarget {
+	for _, target := range manifest.Targets() {
+		if strings.EqualFold(target.Repository, repository) {
+			return &target
+		}
+	}
+
+	return nil
+}
+
+func LoadManifest(path string) (*Manifest, error) {
+	extension := filepath.Ext(path)
+	if extension != ".yaml" && extension != ".yml" && extension != ".json" {
+		return nil, fmt.Errorf("could not load manifest '%s', expected a '.yaml', '.yml' or '.json' file", path)
+	}
+
+	contents, err := ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest '%s': %w", path, err)
+	}
+
+	manifest, err := ParseManifest(contents)
+	if err != nil {
+		return nil, fmt.Errorf("%w: manifest '%s': %w", ErrInvalidConfig, path, err)
+	}
+
+	return manifest, nil
+}
+
+func ParseManifest(contents string) (*Manifest, error) {
+	// JSON is a subset of YAML, so both formats go through the same strict decoder.
+	decoder := yaml.NewDecoder(bytes.NewBufferString(contents))
+	decoder.KnownFields(true)
+
+	var manifest Manifest
+	if err := decoder.Decode(&manifest); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("manifest is empty")
+		}
+		return nil, err
+	}
+
+	if err := manifest.validate(); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+func (manifest *Manifest) validate() error {
+	var problems []error
+
+	if manifest.Version != ManifestVersion {
+		problems = append(problems, fmt.Errorf("version: expected %v, got %v", ManifestVersion, manifest.Version))
+	}
+
+	if manifest.Defaults.Repository != "" {
+		problems = append(problems, errors.New("defaults: 'repository' cannot have a default"))
+	}
+	problems = append(problems, validateFileSets("defaults", manifest.Defaults.Files)...)
+	problems = append(problems, validateChecks("defaults", manifest.Defaults.Checks)...)
+	problems = append(problems, validateMerge("defaults", manifest.Defaults.Merge)...)
+
+	if len(manifest.Repositories) == 0 {
+		problems = append(problems, errors.New("repositories: expected at least one repository"))
+	}
+
+	seenRepos := map[string]int{}
+	for index, target := range manifest.Repositories {
+		location := fmt.Sprintf("repositories[%v]", index)
+		if target.Repository != "" {
+			location = fmt.Sprintf("%s (%q)", location, target.Repository)
+		}
+
+		if !isRepoIdentifier(target.Repository) {
+			problems = append(problems, fmt.Errorf("%s: repository identifier was not in the correct format (i.e. \"owner/name\")", location))
+		} else if seenIndex, seen := seenRepos[target.Repository]; seen {
+			problems = append(problems, fmt.Errorf("%s: repository is already listed at repositories[%v]", location, seenIndex))
+		} else {
+			seenRepos[target.Repository] = index
+		}
+
+		problems = append(problems, validateFileSets(location, target.Files)...)
+		problems = append(problems, validateChecks(location, target.Checks)...)
+		// Merge settings conflict with each other across the defaults, e.g. a method with a
+		// default "queue" mode.
+		problems = append(problems, validateMerge(location, manifest.resolve(target).Merge)...)
+	}
+
+	return errors.Join(problems...)
+}
+
+// ValidateVersions checks that every pinned version is a tag of the source repository, which
+// validate cannot do without the tags.
+func (manifest *Manifest) ValidateVersions(tagCommits map[string]string) error {
+	var problems []error
+
+	if version := manifest.Defaults.Version; version != "" && tagCommits[version] == "" {
+		problems = append(problems, fmt.Errorf("defaults.version: tag '%s' does not exist in the source repository: %w", version, ErrTagNotFound))
+	}
+
+	for index, target := range manifest.Repositories {
+		if target.Version != "" && tagCommits[target.Version] == "" {
+			problems = append(problems, fmt.Errorf("repositories[%v] (%q).version: tag '%s' does not exist in the source repository: %w", index, target.Repository, target.Version, ErrTagNotFound))
+		}
+	}
+
+	return errors.Join(problems...)
+}
+
+func validateFileSets(location string, fileSets []FileSet) []error {
+	var problems []error
+
+	for index, fileSet := range fileSets {
+		fileSetLocation := fmt.Sprintf("%s.files[%v]", location, index)
+
+		if fileSet.Source == "" {
+			problems = append(problems, fmt.Errorf("%s: 'source' is required", fileSetLocation))
+		} else if filepath.IsAbs(fileSet.Source) || strings.HasPrefix(path.Clean(fileSet.Source), "..") {
+			problems = append(problems, fmt.Errorf("%s: 'source' must be a path inside the repository, got '%s'", fileSetLocation, fileSet.Source))
+		} else if _, err := globToRegexp(fileSet.Source); err != nil {
+			problems = append(problems, fmt.Errorf("%s: 'source' is not a valid glob: %w", fileSetLocation, err))
+		}
+		if filepath.IsAbs(fileSet.Destination) || strings.HasPrefix(path.Clean(fileSet.Destination), "..") {
+			problems = append(problems, fmt.Errorf("%s: 'destination' must be a path inside the repository, got '%s'", fileSetLocation, fileSet.Destination))
+		} else if isGlob(fileSet.Destination) {
+			problems = append(problems, fmt.Errorf("%s: 'destination' cannot contain wildcards, got '%s'", fileSetLocation, fileSet.Destination))
+		}
+		if fileSet.Ownership != "" && !slices.Contains(Ownerships, fileSet.Ownership) {
+			problems = append(problems, fmt.Errorf("%s: 'ownership' must be one of '%s', got '%s'", fileSetLocation, strings.Join(Ownerships, "', '"), fileSet.Ownership))
+		}
+		if fileSet.Comment != "" && fileSet.Ownership != OwnershipBlock {
+			problems = append(problems, fmt.Errorf("%s: 'comment' requires 'ownership' to be '%s'", fileSetLocation, OwnershipBlock))
+		} else if fileSet.Comment != "" && !isValidBlockComment(fileSet.Comment) {
+			problems = append(problems, fmt.Errorf("%s: 'comment' must be a line comment (e.g. \"#\") or the start and end of a comment (e.g. \"<!-- -->\"), got '%s'", fileSetLocation, fileSet.Comment))
+		}
+	}
+
+	return problems
+}
+
+func validateChecks(location string, checks ChecksConfig) []error {
+	var problems []error
+
+	durations := []struct{ key, value string }{{"timeout", checks.Timeout}, {"interval", checks.Interval}}
+	for _, duration := range durations {
+		if duration.value == "" {
+			continue
+		}
+
+		if parsed, err := time.ParseDuration(duration.value); err != nil || parsed <= 0 {
+			problems = append(problems, fmt.Errorf("%s.checks: '%s' must be a positive duration (e.g. \"10m\"), got '%s'", location, duration.key, duration.value))
+		}
+	}
+
+	if checks.Grace != "" {
+		if parsed, err := time.ParseDuration(checks.Grace); err != nil || parsed < 0 {
+			problems = append(problems, fmt.Errorf("%s.checks: 'grace' must be a duration of at least \"0s\" (e.g. \"2m\"), got '%s'", location, checks.Grace))
+		}
+	}
+
+	for index, name := range checks.Required {
+		if strings.TrimSpace(name) == "" {
+			problems = append(problems, fmt.Errorf("%s.checks.required[%v]: check name cannot be empty", location, index))
+		}
+	}
+
+	return problems
+}
+
+func validateMerge(location string, merge MergeConfig) []error {
+	var problems []error
+
+	if merge.Mode != "" && !slices.Contains(MergeModes, merge.Mode) {
+		problems = append(problems, fmt.Errorf("%s.merge: 'mode' must be one of '%s', got '%s'", location, strings.Join(MergeModes, "', '"), merge.Mode))
+	}
+	if merge.Method != "" && !slices.Contains(MergeMethods, merge.Method) {
+		problems = append(problems, fmt.Errorf("%s.merge: 'method' must be one of '%s', got '%s'", location, strings.Join(MergeMethods, "', '"), merge.Method))
+	}
+	if merge.Mode == MergeModeQueue && (merge.Method != "" || merge.CommitTitle != "") {
+		problems = append(problems, fmt.Errorf("%s.merge: 'method' and 'commitTitle' cannot be used with the '%s' mode, the merge queue decides them", location, MergeModeQueue))
+	}
+
+	return problems
+}
+
+func isRepoIdentifier(repo string) bool {
+	ownerNameSlice := strings.Split(repo, "/")
+	return len(ownerNameSlice) == 2 && ownerNameSlice[0] != "" && ownerNameSlice[1] != ""
+}
+
+func (manifest *Manifest) Targets() []SyncTarget {
+	var targets []SyncTarget
+	for _, target := range manifest.Repositories {
+		targets = append(targets, manifest.resolve(target))
+	}
+
+	return targets
+}
+
+func (manifest *Manifest) EnabledTargets() []SyncTarget {
+	var targets []SyncTarget
+	for _, target := range manifest.Targets() {
+		if target.IsEnabled() {
+			targets = append(targets, target)
+		}
+	}
+
+	return targets
+}
+
+// IsSynced tells whether a file of the source repository is synced to any of the repositories.
+func (manifest *Manifest) IsSynced(filePath string) bool {
+	for _, target := range manifest.Targets() {
+		if target.IsSynced(filePath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (manifest *Manifest) resolve(target SyncTarget) SyncTarget {
+	defaults := manifest.Defaults
+	resolved := target
+
+	if resolved.Enabled == nil {
+		resolved.Enabled = defaults.Enabled
+	}
+	if resolved.BaseBranch == "" {
+		resolved.BaseBranch = defaults.BaseBranch
+	}
+	if resolved.Branch == "" {
+		resolved.Branch = defaults.Branch
+	}
+	if resolved.Branch == "" {
+		resolved.Branch = DefaultSyncBranch
+	}
+	if resolved.Version == "" {
+		resolved.Version = defaults.Version
+	}
+	if len(resolved.Files) == 0 {
+		resolved.Files = defaults.Files
+	}
+	if len(resolved.Files) == 0 {
+		resolved.Files = DefaultFileSets
+	}
+	resolved.Files = slices.Clone(resolved.Files)
+	for index := range resolved.Files {
+		if resolved.Files[index].Ownership == "" {
+			resolved.Files[index].Ownership = OwnershipReplace
+		}
+		if resolved.Files[index].Ownership == OwnershipBlock && resolved.Files[index].Comment == "" {
+			resolved.Files[index].Comment = DefaultBlockComment
+		}
+	}
+
+	if resolved.Checks.Enabled == nil {
+		resolved.Checks.Enabled = defaults.Checks.Enabled
+	}
+	if len(resolved.Checks.Required) == 0 {
+		resolved.Checks.Required = defaults.Checks.Required
+	}
+	if resolved.Checks.Timeout == "" {
+		resolved.Checks.Timeout = defaults.Checks.Timeout
+	}
+	if resolved.Checks.Timeout == "" {
+		resolved.Checks.Timeout = DefaultChecksTimeout
+	}
+	if resolved.Checks.Interval == "" {
+		resolved.Checks.Interval = defaults.Checks.Interval
+	}
+	if resolved.Checks.Interval == "" {
+		resolved.Checks.Interval = DefaultChecksInterval
+	}
+	if resolved.Checks.Grace == "" {
+		resolved.Checks.Grace = defaults.Checks.Grace
+	}
+	if resolved.Checks.Grace == "" {
+		resolved.Checks.Grace = DefaultChecksGrace
+	}
+
+	if resolved.Merge.Mode == "" {
+		resolved.Merge.Mode = defaults.Merge.Mode
+	}
+	if resolved.Merge.Mode == "" {
+		resolved.Merge.Mode = MergeModeDirect
+	}
+	if resolved.Merge.Method == "" && resolved.Merge.Mode != MergeModeQueue {
+		resolved.Merge.Method = defaults.Merge.Method
+	}
+	if resolved.Merge.CommitTitle == "" && resolved.Merge.Mode != MergeModeQueue {
+		resolved.Merge.CommitTitle = defaults.Merge.CommitTitle
+	}
+	if resolved.Merge.Approve == nil {
+		resolved.Merge.Approve = defaults.Merge.Approve
+	}
+
+	resolved.Variables = map[string]string{}
+	for key, value := range defaults.Variables {
+		resolved.Variables[key] = value
+	}
+	for key, value := range target.Variables {
+		resolved.Variables[key] = value
+	}
+
+	return resolved
+}
@@ -0,0 +1,153 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseManifestResolvesDefaults(t *testing.T) {
+	manifest, err := ParseManifest(`
+version: 1
+defaults:
+  baseBranch: 'develop'
+  variables:
+    go-version: '1.22'
+  merge:
+    method: 'squash'
+repositories:
+  - repository: 'org/a'
+  - repository: 'org/b'
+    branch: 'custom-sync'
+    version: 'v1'
+    variables:
+      go-version: '1.21'
+`)
+	if err != nil {
+		t.Fatalf("ParseManifest() returned an error: %v", err)
+	}
+
+	targets := manifest.Targets()
+	if len(targets) != 2 {
+		t.Fatalf("Targets() returned %v targets, expected 2", len(targets))
+	}
+
+	first, second := targets[0], targets[1]
+	if first.BaseBranch != "develop" || first.Branch != DefaultSyncBranch || first.Version != "" {
+		t.Errorf("first target was resolved to base branch '%s', branch '%s' and version '%s'", first.BaseBranch, first.Branch, first.Version)
+	}
+	if len(first.Files) != 1 || first.Files[0].Source != DefaultFileSets[0].Source {
+		t.Errorf("first target was resolved to files %+v, expected the default file sets", first.Files)
+	}
+	if first.Merge.Mode != MergeModeDirect || first.Merge.Method != "squash" {
+		t.Errorf("first target was resolved to merge mode '%s' and method '%s'", first.Merge.Mode, first.Merge.Method)
+	}
+	if first.Checks.Timeout != DefaultChecksTimeout || first.Checks.Interval != DefaultChecksInterval || first.Checks.Grace != DefaultChecksGrace {
+		t.Errorf("first target was resolved to checks timeout '%s', interval '%s' and grace '%s'", first.Checks.Timeout, first.Checks.Interval, first.Checks.Grace)
+	}
+	if first.Variables["go-version"] != "1.22" || second.Variables["go-version"] != "1.21" {
+		t.Errorf("variables were resolved to %v and %v", first.Variables, second.Variables)
+	}
+	if second.Branch != "custom-sync" || second.Version != "v1" {
+		t.Errorf("second target was resolved to branch '%s' and version '%s'", second.Branch, second.Version)
+	}
+}
+
+func TestParseManifestAcceptsJSON(t *testing.T) {
+	manifest, err := ParseManifest(`{"version": 1, "repositories": [{"repository": "org/a"}]}`)
+	if err != nil {
+		t.Fatalf("ParseManifest() returned an error: %v", err)
+	}
+
+	if target := manifest.Target("ORG/A"); target == nil {
+		t.Errorf("Target() did not find 'org/a' case-insensitively")
+	}
+}
+
+func TestParseManifestReportsProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		problems []string
+	}{
+		{
+			name:     "empty",
+			manifest: "",
+			problems: []string{"manifest is empty"},
+		},
+		{
+			name:     "unsupported version",
+			manifest: "version: 2\nrepositories:\n  - repository: 'org/a'\n",
+			problems: []string{"version: expected 1, got 2"},
+		},
+		{
+			name:     "unknown field",
+			manifest: "version: 1\nrepositories:\n  - repository: 'org/a'\n    unknown: true\n",
+			problems: []string{"field unknown not found"},
+		},
+		{
+			name:     "no repositories",
+			manifest: "version: 1\nrepositories: []\n",
+			problems: []string{"expected at least one repository"},
+		},
+		{
+			name:     "invalid and duplicate repositories",
+			manifest: "version: 1\nrepositories:\n  - repository: 'a'\n  - repository: 'org/b'\n  - repository: 'org/b'\n",
+			problems: []string{`repositories[0] ("a"): repository identifier`, `repositories[2] ("org/b"): repository is already listed at repositories[1]`},
+		},
+		{
+			name:     "invalid file sets",
+			manifest: "version: 1\nrepositories:\n  - repository: 'org/a'\n    files:\n      - source: '../outside'\n      - source: 'a/*'\n        destination: 'b/*'\n      - source: 'a'\n        ownership: 'steal'\n      - source: 'a'\n        comment: '#'\n",
+			problems: []string{"files[0]: 'source' must be a path inside the repository", "files[1]: 'destination' cannot contain wildcards", "files[2]: 'ownership' must be one of", "files[3]: 'comment' requires 'ownership'"},
+		},
+		{
+			name:     "invalid checks",
+			manifest: "version: 1\nrepositories:\n  - repository: 'org/a'\n    checks:\n      timeout: 'soon'\n      grace: '-1m'\n      required: ['']\n",
+			problems: []string{"'timeout' must be a positive duration", "'grace' must be a duration", "check name cannot be empty"},
+		},
+		{
+			name:     "invalid merge",
+			manifest: "version: 1\nrepositories:\n  - repository: 'org/a'\n    merge:\n      mode: 'later'\n      method: 'octopus'\n",
+			problems: []string{"'mode' must be one of", "'method' must be one of"},
+		},
+		{
+			name:     "merge method with a default queue mode",
+			manifest: "version: 1\ndefaults:\n  merge:\n    mode: 'queue'\nrepositories:\n  - repository: 'org/a'\n  - repository: 'org/b'\n    merge:\n      method: 'squash'\n",
+			problems: []string{`repositories[1] ("org/b").merge: 'method' and 'commitTitle' cannot be used with the 'queue' mode`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseManifest(test.manifest)
+			if err == nil {
+				t.Fatalf("ParseManifest() did not return an error")
+			}
+
+			for _, problem := range test.problems {
+				if !strings.Contains(err.Error(), problem) {
+					t.Errorf("ParseManifest() returned %q, expected it to contain %q", err, problem)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateVersions(t *testing.T) {
+	manifest, err := ParseManifest("version: 1\ndefaults:\n  version: 'v1'\nrepositories:\n  - repository: 'org/a'\n  - repository: 'org/b'\n    version: 'v1.2.0'\n  - repository: 'org/c'\n    version: 'v9'\n")
+	if err != nil {
+		t.Fatalf("ParseManifest() returned an error: %v", err)
+	}
+
+	err = manifest.ValidateVersions(map[string]string{"v1": "abc", "v1.2.0": "def"})
+	if !errors.Is(err, ErrTagNotFound) {
+		t.Fatalf("ValidateVersions() returned %v, expected ErrTagNotFound", err)
+	}
+	if !strings.Contains(err.Error(), `repositories[2] ("org/c").version: tag 'v9'`) || strings.Contains(err.Error(), "v1.2.0") {
+		t.Errorf("ValidateVersions() returned %q, expected only 'v9' to be missing", err)
+	}
+
+	if err := manifest.ValidateVersions(map[string]string{"v1": "abc", "v1.2.0": "def", "v9": "ghi"}); err != nil {
+		t.Errorf("ValidateVersions() returned %v, expected every tag to exist", err)
+	}
+}
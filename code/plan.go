@@ -0,0 +1,75 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type FileChange struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+type RepositoryPlan struct {
+	Repository string       `json:"repository"`
+	BaseBranch string       `json:"baseBranch"`
+	Version    string       `json:"version"`
+	Changes    []FileChange `json:"changes"`
+	Diff       string       `json:"diff"`
+	Error      string       `json:"error,omitempty"`
+}
+
+func (plan *RepositoryPlan) HasChanges() bool {
+	return len(plan.Changes) > 0
+}
+
+func (syncer *Syncer) PlanRepository(target SyncTarget, versionTag string) (*RepositoryPlan, error) {
+	baseBranch, versionTag, err := syncer.resolveSync(target, versionTag)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, changedPaths, err := syncer.locallySync(target, baseBranch, versionTag)
+	if err != nil {
+		return nil, fmt.Errorf("could not sync locally: %w", err)
+	}
+
+	plan := &RepositoryPlan{
+		Repository: target.Repository,
+		BaseBranch: baseBranch,
+		Version:    versionTag,
+		Changes:    []FileChange{},
+	}
+
+	// Staging makes untracked (i.e. added) files show up in the diff as well.
+	if err := repo.Add(changedPaths); err != nil {
+		return nil, err
+	}
+
+	changes, err := repo.StagedChanges()
+	if err != nil {
+		return nil, err
+	}
+	plan.Changes = changes
+
+	diff, err := repo.StagedDiff()
+	if err != nil {
+		return nil, err
+	}
+	plan.Diff = diff
+
+	return plan, nil
+}
+
+func WritePlans(path string, plans []RepositoryPlan) error {
+	plansJson, err := json.MarshalIndent(plans, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not convert plans to JSON: %w", err)
+	}
+
+	if err := WriteFile(path, string(plansJson)); err != nil {
+		return fmt.Errorf("could not write plans to '%s': %w", path, err)
+	}
+
+	return nil
+}
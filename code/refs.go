@@ -0,0 +1,155 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+type textEdit struct {
+	start       int
+	end         int
+	replacement string
+}
+
+// RewriteWorkflowRefs points every `uses:` of a workflow or action from sourceRepo at versionTag,
+// along with empty `go-file-ref` inputs passed to them. Only those values are edited in the
+// original text, so comments and formatting are kept as they are.
+func RewriteWorkflowRefs(contents string, sourceRepo string, versionTag string) (string, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(contents), &document); err != nil {
+		return "", fmt.Errorf("could not parse workflow: %w", err)
+	}
+
+	var edits []textEdit
+	var walk func(node *yaml.Node) error
+	walk = func(node *yaml.Node) error {
+		if uses := mappingValue(node, "uses"); uses != nil && isSourceReference(uses.Value, sourceRepo) {
+			oldRef := uses.Value[strings.LastIndex(uses.Value, "@")+1:]
+			edit, err := rewriteScalar(contents, uses, func(raw string) string {
+				refIndex := strings.LastIndex(raw, "@"+oldRef) + 1
+				return raw[:refIndex] + versionTag + raw[refIndex+len(oldRef):]
+			})
+			if err != nil {
+				return err
+			}
+			edits = append(edits, edit)
+
+			// An empty `go-file-ref` means "the same ref as the workflow", which is now versionTag.
+			if goFileRef := mappingValue(mappingValue(node, "with"), "go-file-ref"); goFileRef != nil && goFileRef.Tag == "!!str" && goFileRef.Value == "" {
+				edit, err := rewriteScalar(contents, goFileRef, func(raw string) string {
+					return raw[:1] + versionTag + raw[1:]
+				})
+				if err != nil {
+					return err
+				}
+				edits = append(edits, edit)
+			}
+		}
+
+		for _, child := range node.Content {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+	if err := walk(&document); err != nil {
+		return "", err
+	}
+
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	for _, edit := range edits {
+		contents = contents[:edit.start] + edit.replacement + contents[edit.end:]
+	}
+
+	return contents, nil
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for index := 0; index+1 < len(mapping.Content); index += 2 {
+		if mapping.Content[index].Value == key {
+			return mapping.Content[index+1]
+		}
+	}
+
+	return nil
+}
+
+// isSourceReference matches "owner/name@ref" and "owner/name/path@ref", but not local ("./path")
+// or Docker ("docker://image") references.
+func isSourceReference(uses string, sourceRepo string) bool {
+	if !strings.Contains(uses, "@") || sourceRepo == "" {
+		return false
+	}
+
+	prefix := strings.ToLower(sourceRepo)
+	reference := strings.ToLower(uses)
+	return strings.HasPrefix(reference, prefix+"@") || strings.HasPrefix(reference, prefix+"/")
+}
+
+// rewriteScalar finds the text of a single-line scalar from its position, and replaces it
+// with what rewrite returns for that text (including any quotes).
+func rewriteScalar(contents string, node *yaml.Node, rewrite func(raw string) string) (textEdit, error) {
+	start := 0
+	for line := 1; line < node.Line; line++ {
+		newlineIndex := strings.IndexByte(contents[start:], '\n')
+		if newlineIndex < 0 {
+			return textEdit{}, fmt.Errorf("could not find line %v", node.Line)
+		}
+		start += newlineIndex + 1
+	}
+	for column := 1; column < node.Column && start < len(contents); column++ {
+		_, width := utf8.DecodeRuneInString(contents[start:])
+		start += width
+	}
+
+	lineEnd := strings.IndexByte(contents[start:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(contents) - start
+	}
+	line := contents[start : start+lineEnd]
+
+	var length int
+	switch node.Style {
+	case 0, yaml.FlowStyle:
+		length = len(node.Value)
+	case yaml.SingleQuotedStyle:
+		length = quotedLength(line, '\'')
+	case yaml.DoubleQuotedStyle:
+		length = quotedLength(line, '"')
+	default:
+		return textEdit{}, fmt.Errorf("line %v: expected a single-line value", node.Line)
+	}
+	if length <= 0 || length > len(line) {
+		return textEdit{}, fmt.Errorf("line %v: could not find the end of '%s'", node.Line, node.Value)
+	}
+
+	raw := line[:length]
+	return textEdit{start: start, end: start + length, replacement: rewrite(raw)}, nil
+}
+
+func quotedLength(line string, quote byte) int {
+	for index := 1; index < len(line); index++ {
+		switch {
+		case quote == '"' && line[index] == '\\':
+			index++
+		case line[index] == quote && quote == '\'' && index+1 < len(line) && line[index+1] == '\'':
+			index++
+		case line[index] == quote:
+			return index + 1
+		}
+	}
+
+	return -1
+}
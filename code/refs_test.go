@@ -0,0 +1,105 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestRewriteWorkflowRefs(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected string
+	}{
+		{
+			name:     "plain reusable workflow",
+			contents: "jobs:\n  build:\n    uses: org/common/.github/workflows/build.yaml@main\n",
+			expected: "jobs:\n  build:\n    uses: org/common/.github/workflows/build.yaml@v2\n",
+		},
+		{
+			name:     "single-quoted",
+			contents: "jobs:\n  build:\n    uses: 'org/common/.github/workflows/build.yaml@main'\n",
+			expected: "jobs:\n  build:\n    uses: 'org/common/.github/workflows/build.yaml@v2'\n",
+		},
+		{
+			name:     "double-quoted",
+			contents: "jobs:\n  build:\n    uses: \"org/common/.github/workflows/build.yaml@v1.4.0\"\n",
+			expected: "jobs:\n  build:\n    uses: \"org/common/.github/workflows/build.yaml@v2\"\n",
+		},
+		{
+			name:     "single-quoted with an escaped quote before",
+			contents: "name: 'Build ''everything'''\njobs:\n  build:\n    uses: 'org/common/.github/workflows/build.yaml@main'\n",
+			expected: "name: 'Build ''everything'''\njobs:\n  build:\n    uses: 'org/common/.github/workflows/build.yaml@v2'\n",
+		},
+		{
+			name:     "inline comments",
+			contents: "jobs:\n  build: # the build\n    uses: org/common/.github/workflows/build.yaml@main # keep in sync @main\n  lint:\n    uses: 'org/common/.github/workflows/lint.yaml@main' # quoted\n",
+			expected: "jobs:\n  build: # the build\n    uses: org/common/.github/workflows/build.yaml@v2 # keep in sync @main\n  lint:\n    uses: 'org/common/.github/workflows/lint.yaml@v2' # quoted\n",
+		},
+		{
+			name:     "actions in steps",
+			contents: "steps:\n  - uses: actions/checkout@v4\n  - uses: org/common@main\n  - uses: org/common/actions/setup@main\n    with:\n      go-version: '1.22'\n",
+			expected: "steps:\n  - uses: actions/checkout@v4\n  - uses: org/common@v2\n  - uses: org/common/actions/setup@v2\n    with:\n      go-version: '1.22'\n",
+		},
+		{
+			name:     "case-insensitive repository",
+			contents: "jobs:\n  build:\n    uses: Org/Common/.github/workflows/build.yaml@main\n",
+			expected: "jobs:\n  build:\n    uses: Org/Common/.github/workflows/build.yaml@v2\n",
+		},
+		{
+			name:     "non-source references",
+			contents: "jobs:\n  build:\n    uses: org/common-extra/.github/workflows/build.yaml@main\n  local:\n    uses: ./.github/workflows/org/common/build.yaml\n  docker:\n    steps:\n      - uses: docker://org/common@main\n      - uses: other/org/common@main\n",
+			expected: "jobs:\n  build:\n    uses: org/common-extra/.github/workflows/build.yaml@main\n  local:\n    uses: ./.github/workflows/org/common/build.yaml\n  docker:\n    steps:\n      - uses: docker://org/common@main\n      - uses: other/org/common@main\n",
+		},
+		{
+			name:     "flow mapping",
+			contents: "steps:\n  - { uses: org/common/actions/setup@main, with: { go-file-ref: '' } }\n",
+			expected: "steps:\n  - { uses: org/common/actions/setup@v2, with: { go-file-ref: 'v2' } }\n",
+		},
+		{
+			name:     "empty go-file-ref",
+			contents: "jobs:\n  build:\n    uses: org/common/.github/workflows/build.yaml@main\n    with:\n      go-file-ref: \"\"\n      other: ''\n  test:\n    uses: org/common/.github/workflows/test.yaml@main\n    with:\n      go-file-ref: 'v1' # pinned\n",
+			expected: "jobs:\n  build:\n    uses: org/common/.github/workflows/build.yaml@v2\n    with:\n      go-file-ref: \"v2\"\n      other: ''\n  test:\n    uses: org/common/.github/workflows/test.yaml@v2\n    with:\n      go-file-ref: 'v1' # pinned\n",
+		},
+		{
+			name:     "multi-byte characters before the reference",
+			contents: "jobs:\n  build: { name: \"Bäuen ✓\", uses: org/common/.github/workflows/build.yaml@main }\n",
+			expected: "jobs:\n  build: { name: \"Bäuen ✓\", uses: org/common/.github/workflows/build.yaml@v2 }\n",
+		},
+		{
+			name:     "CRLF line endings",
+			contents: "jobs:\r\n  build:\r\n    uses: 'org/common/.github/workflows/build.yaml@main'\r\n",
+			expected: "jobs:\r\n  build:\r\n    uses: 'org/common/.github/workflows/build.yaml@v2'\r\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rewritten, err := RewriteWorkflowRefs(test.contents, "org/common", "v2")
+			if err != nil {
+				t.Fatalf("RewriteWorkflowRefs() returned an error: %v", err)
+			}
+
+			if rewritten != test.expected {
+				t.Errorf("RewriteWorkflowRefs() returned\n%s\nexpected\n%s", rewritten, test.expected)
+			}
+		})
+	}
+}
+
+func TestRewriteWorkflowRefsReportsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"invalid YAML", "jobs:\n  build: [\n"},
+		{"multi-line reference", "jobs:\n  build:\n    uses: >-\n      org/common/.github/workflows/build.yaml@main\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := RewriteWorkflowRefs(test.contents, "org/common", "v2"); err == nil {
+				t.Errorf("RewriteWorkflowRefs() did not return an error")
+			}
+		})
+	}
+}
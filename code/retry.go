@@ -0,0 +1,273 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy retries with an exponentially growing interval, randomized by Jitter (e.g. 0.2 for
+// ±20%), until MaxElapsedTime would pass. Servers that ask to wait longer, e.g. when rate limiting,
+// get the time they ask for.
+type RetryPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	MaxElapsedTime  time.Duration
+	Multiplier      float64
+	Jitter          float64
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	InitialInterval: time.Second,
+	MaxInterval:     30 * time.Second,
+	MaxElapsedTime:  3 * time.Minute,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+// RetryCounts are the number of retries since the start of the process, for the report.
+type RetryCounts struct {
+	API atomic.Int64
+	Git atomic.Int64
+}
+
+var Retries RetryCounts
+
+// Summary is empty when nothing had to be retried.
+func (counts *RetryCounts) Summary() string {
+	apiRetries, gitRetries := counts.API.Load(), counts.Git.Load()
+	if apiRetries == 0 && gitRetries == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("*Retried `%v` GitHub API request(s) and `%v` git command(s) after transient errors or rate limits.*", apiRetries, gitRetries)
+}
+
+// RetryableError marks an error as transient, optionally with how long to wait before retrying.
+type RetryableError struct {
+	Err   error
+	After time.Duration
+}
+
+func (err *RetryableError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *RetryableError) Unwrap() error {
+	return err.Err
+}
+
+func (policy RetryPolicy) interval(retry int) time.Duration {
+	interval := float64(policy.InitialInterval)
+	for range retry {
+		interval *= policy.Multiplier
+	}
+	interval = min(interval, float64(policy.MaxInterval))
+
+	return time.Duration(interval * (1 + policy.Jitter*(2*rand.Float64()-1)))
+}
+
+// Do runs operation until it succeeds, returns an error that is not a RetryableError, or the next
+// retry would exceed the maximum elapsed time. It returns how often operation was retried.
+func (policy RetryPolicy) Do(description string, operation func() error) (int, error) {
+	startTime := time.Now()
+	for retry := 0; ; retry++ {
+		err := operation()
+
+		var retryableError *RetryableError
+		if !errors.As(err, &retryableError) {
+			return retry, err
+		}
+
+		wait := max(policy.interval(retry), retryableError.After)
+		if time.Since(startTime)+wait > policy.MaxElapsedTime {
+			return retry, fmt.Errorf("gave up after %v retries: %w", retry, retryableError)
+		}
+
+		log.Printf("Retrying %s in %s: %v\n", description, wait.Round(time.Millisecond), retryableError.Err)
+		time.Sleep(wait)
+	}
+}
+
+// retryTransport retries GitHub API requests that failed with a transient error or were rate
+// limited. Requests that create something (POST) are only retried when they were rate limited,
+// since they may have been processed despite the error.
+type retryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+}
+
+func NewRetryTransport(base http.RoundTripper, policy RetryPolicy) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &retryTransport{base: base, policy: policy}
+}
+
+func (transport *retryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil && request.GetBody == nil {
+		return transport.base.RoundTrip(request)
+	}
+
+	var response *http.Response
+	attempts := 0
+	retries, err := transport.policy.Do(fmt.Sprintf("%s %s", request.Method, request.URL.Path), func() error {
+		attempt := request
+		if attempts > 0 {
+			if response != nil {
+				response.Body.Close()
+			}
+
+			attempt = request.Clone(request.Context())
+			if request.Body != nil {
+				body, err := request.GetBody()
+				if err != nil {
+					return err
+				}
+				attempt.Body = body
+			}
+		}
+		attempts += 1
+
+		var err error
+		response, err = transport.base.RoundTrip(attempt)
+		return classifyResponse(request, response, err)
+	})
+	Retries.API.Add(int64(retries))
+
+	// When giving up on a response, it is returned as is, so that the client can report it.
+	var retryableError *RetryableError
+	if response != nil && errors.As(err, &retryableError) {
+		return response, nil
+	}
+
+	return response, err
+}
+
+func classifyResponse(request *http.Request, response *http.Response, err error) error {
+	if err != nil {
+		if request.Context().Err() != nil || request.Method == http.MethodPost {
+			return err
+		}
+		return &RetryableError{Err: err}
+	}
+
+	if after, isRateLimited := rateLimitWait(response); isRateLimited {
+		return &RetryableError{Err: fmt.Errorf("rate limited (%s)", response.Status), After: after}
+	}
+
+	switch response.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusInternalServerError:
+		if request.Method == http.MethodPost {
+			return nil
+		}
+		return &RetryableError{Err: fmt.Errorf("server error (%s)", response.Status)}
+	}
+
+	return nil
+}
+
+// rateLimitWait recognizes the primary rate limit (X-RateLimit-Remaining is 0) and secondary
+// rate limits (Retry-After), see https://docs.github.com/en/rest/using-the-rest-api/rate-limits-for-the-rest-api.
+// Retry-After is either seconds or an HTTP date, when it is neither, the wait is 0 so that the
+// exponential backoff of the RetryPolicy applies.
+func rateLimitWait(response *http.Response) (time.Duration, bool) {
+	if response.StatusCode != http.StatusForbidden && response.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if retryAfter := response.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return max(time.Duration(seconds)*time.Second, 0), true
+		}
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			return max(time.Until(date), 0), true
+		}
+		return 0, true
+	}
+
+	if response.Header.Get("X-RateLimit-Remaining") == "0" {
+		reset, err := strconv.ParseInt(response.Header.Get("X-RateLimit-Reset"), 10, 64)
+		if err != nil {
+			return time.Minute, true
+		}
+		return max(time.Until(time.Unix(reset, 0)), 0), true
+	}
+
+	return 0, response.StatusCode == http.StatusTooManyRequests
+}
+
+var gitNetworkCommands = []string{"clone", "fetch", "pull", "push", "ls-remote"}
+
+// transientGitErrors are failures of git network commands that are worth retrying, unlike
+// e.g. rejected pushes or failed authentication.
+var transientGitErrors = []string{
+	"could not resolve host",
+	"connection timed out",
+	"connection reset",
+	"connection refused",
+	"operation timed out",
+	"the remote end hung up unexpectedly",
+	"early eof",
+	"rpc failed",
+	"the requested url returned error: 429",
+	"the requested url returned error: 5",
+	"gnutls_handshake",
+	"ssl_read",
+	"ssl_connect",
+}
+
+// gitSubcommand skips the global options of git, e.g. "-C <dir>", to find the command.
+func gitSubcommand(args []string) string {
+	for index := 0; index < len(args); index++ {
+		switch {
+		case args[index] == "-C" || args[index] == "-c":
+			index++
+		case !strings.HasPrefix(args[index], "-"):
+			return args[index]
+		}
+	}
+
+	return ""
+}
+
+// runGitCommand retries git commands that talk to a remote when they fail with a transient error.
+func runGitCommand(env []string, args ...string) (string, error) {
+	subcommand := gitSubcommand(args)
+	if !slices.Contains(gitNetworkCommands, subcommand) {
+		return runCommand(env, "git", args...)
+	}
+
+	var out string
+	retries, err := DefaultRetryPolicy.Do("git "+subcommand, func() error {
+		var err error
+		out, err = runCommand(env, "git", args...)
+		return classifyGitError(err)
+	})
+	Retries.Git.Add(int64(retries))
+
+	return out, err
+}
+
+func classifyGitError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, transientError := range transientGitErrors {
+		if strings.Contains(message, transientError) {
+			return &RetryableError{Err: err}
+		}
+	}
+
+	return err
+}
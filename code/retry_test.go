@@ -0,0 +1,202 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	InitialInterval: time.Millisecond,
+	MaxInterval:     10 * time.Millisecond,
+	MaxElapsedTime:  time.Second,
+	Multiplier:      2,
+}
+
+func TestRetryTransport(t *testing.T) {
+	rateLimitReset := func(header http.Header) {
+		header.Set("X-RateLimit-Remaining", "0")
+		header.Set("X-RateLimit-Reset", "1")
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		status         int
+		header         func(header http.Header)
+		expectedStatus int
+		requests       int
+	}{
+		{"too many requests", http.MethodGet, http.StatusTooManyRequests, func(header http.Header) { header.Set("Retry-After", "0") }, http.StatusOK, 2},
+		{"too many requests without Retry-After", http.MethodGet, http.StatusTooManyRequests, nil, http.StatusOK, 2},
+		{"primary rate limit", http.MethodGet, http.StatusForbidden, rateLimitReset, http.StatusOK, 2},
+		{"rate limited POST", http.MethodPost, http.StatusForbidden, rateLimitReset, http.StatusOK, 2},
+		{"forbidden", http.MethodGet, http.StatusForbidden, nil, http.StatusForbidden, 1},
+		{"bad gateway", http.MethodGet, http.StatusBadGateway, nil, http.StatusOK, 2},
+		{"bad gateway of a POST", http.MethodPost, http.StatusBadGateway, nil, http.StatusBadGateway, 1},
+		{"not found", http.MethodGet, http.StatusNotFound, nil, http.StatusNotFound, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				requests += 1
+				if requests > 1 {
+					writer.WriteHeader(http.StatusOK)
+					return
+				}
+
+				if test.header != nil {
+					test.header(writer.Header())
+				}
+				writer.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			retriesBefore := Retries.API.Load()
+			client := &http.Client{Transport: NewRetryTransport(nil, testRetryPolicy)}
+			request, err := http.NewRequest(test.method, server.URL, strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatalf("Do() returned an error: %v", err)
+			}
+			response.Body.Close()
+
+			if response.StatusCode != test.expectedStatus || requests != test.requests {
+				t.Errorf("Do() returned %v after %v request(s), expected %v after %v", response.StatusCode, requests, test.expectedStatus, test.requests)
+			}
+			if retries := Retries.API.Load() - retriesBefore; retries != int64(test.requests-1) {
+				t.Errorf("Retries.API counted %v retries, expected %v", retries, test.requests-1)
+			}
+		})
+	}
+}
+
+func TestRetryTransportGivesUp(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests += 1
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	policy := testRetryPolicy
+	policy.MaxElapsedTime = 20 * time.Millisecond
+	client := &http.Client{Transport: NewRetryTransport(nil, policy)}
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() returned an error: %v", err)
+	}
+	response.Body.Close()
+
+	// The last response is returned as is, so that the client reports it.
+	if response.StatusCode != http.StatusServiceUnavailable || requests < 2 {
+		t.Errorf("Get() returned %v after %v request(s), expected to give up after retrying", response.StatusCode, requests)
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	retryDate := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		name          string
+		status        int
+		header        map[string]string
+		minimum       time.Duration
+		maximum       time.Duration
+		isRateLimited bool
+	}{
+		{"not rate limited", http.StatusBadGateway, map[string]string{"Retry-After": "5"}, 0, 0, false},
+		{"seconds", http.StatusTooManyRequests, map[string]string{"Retry-After": "5"}, 5 * time.Second, 5 * time.Second, true},
+		{"HTTP date", http.StatusForbidden, map[string]string{"Retry-After": retryDate}, 59 * time.Minute, time.Hour, true},
+		{"HTTP date in the past", http.StatusForbidden, map[string]string{"Retry-After": "Wed, 21 Oct 2015 07:28:00 GMT"}, 0, 0, true},
+		{"invalid Retry-After", http.StatusTooManyRequests, map[string]string{"Retry-After": "soon"}, 0, 0, true},
+		{"primary rate limit without reset", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0"}, time.Minute, time.Minute, true},
+		{"forbidden", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "12"}, 0, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := &http.Response{StatusCode: test.status, Header: http.Header{}}
+			for key, value := range test.header {
+				response.Header.Set(key, value)
+			}
+
+			wait, isRateLimited := rateLimitWait(response)
+			if isRateLimited != test.isRateLimited || wait < test.minimum || wait > test.maximum {
+				t.Errorf("rateLimitWait() = %s, %v, expected %s to %s, %v", wait, isRateLimited, test.minimum, test.maximum, test.isRateLimited)
+			}
+		})
+	}
+}
+
+func TestClassifyGitError(t *testing.T) {
+	tests := []struct {
+		stderr    string
+		retryable bool
+	}{
+		{"fatal: unable to access 'https://github.com/org/a/': Could not resolve host: github.com", true},
+		{"error: RPC failed; HTTP 502 curl 22 The requested URL returned error: 502", true},
+		{"fatal: unable to access 'https://github.com/org/a/': The requested URL returned error: 429", true},
+		{"fatal: the remote end hung up unexpectedly", true},
+		{"fatal: Authentication failed for 'https://github.com/org/a/'", false},
+		{"! [rejected] main -> main (non-fast-forward)", false},
+		{"fatal: unable to access 'https://github.com/org/a/': The requested URL returned error: 403", false},
+	}
+
+	for _, test := range tests {
+		err := classifyGitError(&CommandError{Command: "git", Stderr: test.stderr, Err: errors.New("exit status 128")})
+
+		var retryableError *RetryableError
+		if errors.As(err, &retryableError) != test.retryable {
+			t.Errorf("classifyGitError(%q) returned %v, expected retryable %v", test.stderr, err, test.retryable)
+		}
+	}
+
+	if err := classifyGitError(nil); err != nil {
+		t.Errorf("classifyGitError(nil) returned %v", err)
+	}
+}
+
+func TestGitSubcommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-C", "dir", "-c", "credential.helper=", "push", "origin", "main"}, "push"},
+		{[]string{"--no-pager", "fetch", "--tags"}, "fetch"},
+		{[]string{"-C", "dir"}, ""},
+	}
+
+	for _, test := range tests {
+		if subcommand := gitSubcommand(test.args); subcommand != test.expected {
+			t.Errorf("gitSubcommand(%q) = %q, expected %q", test.args, subcommand, test.expected)
+		}
+	}
+}
+
+func TestRunGitCommandDoesNotRetryPermanentErrors(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	retriesBefore := Retries.Git.Load()
+	_, err := runGitCommand(nil, "ls-remote", filepath.Join(t.TempDir(), "missing.git"))
+
+	var retryableError *RetryableError
+	if err == nil || errors.As(err, &retryableError) {
+		t.Errorf("runGitCommand() of a missing repository returned %v, expected a permanent error", err)
+	}
+	if retries := Retries.Git.Load() - retriesBefore; retries != 0 {
+		t.Errorf("Retries.Git counted %v retries of a permanent error", retries)
+	}
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	gogithub "github.com/google/go-github/v62/github"
+)
+
+// The record of the last sync run is kept on its own branch of the source repository, so that
+// updating it does not trigger another run.
+const (
+	RunRecordBranch = "sync-state"
+	RunRecordPath   = "sync-run.json"
+)
+
+type RunRecord struct {
+	RunId        int64                 `json:"runId"`
+	RunNumber    int                   `json:"runNumber"`
+	RunURL       string                `json:"runUrl"`
+	Version      string                `json:"version"`
+	FinishedAt   time.Time             `json:"finishedAt"`
+	Repositories []RepositoryRunRecord `json:"repositories"`
+}
+
+type RepositoryRunRecord struct {
+	Repository string `json:"repository"`
+	Error      string `json:"error,omitempty"`
+}
+
+func NewRunRecord(workflowRun *gogithub.WorkflowRun, versionTag string) *RunRecord {
+	return &RunRecord{
+		RunId:        workflowRun.GetID(),
+		RunNumber:    workflowRun.GetRunNumber(),
+		RunURL:       workflowRun.GetHTMLURL(),
+		Version:      versionTag,
+		FinishedAt:   time.Now().UTC(),
+		Repositories: []RepositoryRunRecord{},
+	}
+}
+
+func (record *RunRecord) Add(repository string, err error) {
+	repositoryRecord := RepositoryRunRecord{Repository: repository}
+	if err != nil {
+		repositoryRecord.Error = Secrets.Redact(err.Error())
+	}
+
+	record.Repositories = append(record.Repositories, repositoryRecord)
+}
+
+func (record *RunRecord) Failed() []RepositoryRunRecord {
+	var failed []RepositoryRunRecord
+	for _, repositoryRecord := range record.Repositories {
+		if repositoryRecord.Error != "" {
+			failed = append(failed, repositoryRecord)
+		}
+	}
+
+	return failed
+}
+
+// LoadRunRecord returns nil when no run was recorded yet.
+func LoadRunRecord(api GitHubAPI, repository string) (*RunRecord, error) {
+	owner, name, err := RepoOwnerName(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, found, err := GetRemoteFile(api, owner, name, RunRecordPath, RunRecordBranch)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	var record RunRecord
+	if err := json.Unmarshal([]byte(contents), &record); err != nil {
+		return nil, fmt.Errorf("could not parse run record '%s': %w", RunRecordPath, err)
+	}
+
+	return &record, nil
+}
+
+// SaveRunRecord replaces the recorded run, creating the branch of the record from the default
+// branch if it does not exist yet.
+func SaveRunRecord(api GitHubAPI, repository string, record *RunRecord) error {
+	ctx := context.Background()
+	owner, name, err := RepoOwnerName(repository)
+	if err != nil {
+		return err
+	}
+
+	branchExists, err := RemoteBranchExists(api, owner, name, RunRecordBranch)
+	if err != nil {
+		return err
+	}
+	if !branchExists {
+		defaultBranch, err := GetDefaultBranch(api, owner, name)
+		if err != nil {
+			return err
+		}
+
+		defaultBranchInfo, err := api.GetBranch(ctx, owner, name, defaultBranch)
+		if err != nil {
+			return fmt.Errorf("could not get default branch '%s' of '%s': %w", defaultBranch, repository, err)
+		}
+		if defaultBranchInfo == nil {
+			return fmt.Errorf("could not get default branch '%s' of '%s': %w", defaultBranch, repository, ErrBranchNotFound)
+		}
+
+		if err := api.CreateBranch(ctx, owner, name, RunRecordBranch, defaultBranchInfo.GetCommit().GetSHA()); err != nil {
+			return fmt.Errorf("could not create branch '%s' in '%s': %w", RunRecordBranch, repository, err)
+		}
+	}
+
+	existingFile, err := api.GetFileContents(ctx, owner, name, RunRecordPath, RunRecordBranch)
+	if err != nil {
+		return fmt.Errorf("could not get '%s' from '%s@%s': %w", RunRecordPath, repository, RunRecordBranch, err)
+	}
+
+	recordJson, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not convert run record to JSON: %w", err)
+	}
+
+	options := &gogithub.RepositoryContentFileOptions{
+		Message: gogithub.String(fmt.Sprintf("Record sync run #%v", record.RunNumber)),
+		Content: append(recordJson, '\n'),
+		Branch:  gogithub.String(RunRecordBranch),
+	}
+	if existingFile != nil {
+		options.SHA = existingFile.SHA
+	}
+
+	if err := api.PutFileContents(ctx, owner, name, RunRecordPath, options); err != nil {
+		return fmt.Errorf("could not write '%s' to '%s@%s': %w", RunRecordPath, repository, RunRecordBranch, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Shorter values would also be replaced inside of ordinary words.
+const minSecretLength = 8
+
+// secretEnvKeys are registered by SetupRedaction, so that they are hidden even when never used.
+var secretEnvKeys = []string{
+	"GH_PAT_MF",
+	"GH_PAT_AYYXD",
+	"GH_APP_PRIVATE_KEY",
+	"GH_APPROVER_APP_PRIVATE_KEY",
+}
+
+// SecretRegistry knows every secret of the process, and the forms they can appear in, e.g. in an
+// "Authorization: Basic" header or a URL.
+type SecretRegistry struct {
+	mutex   sync.RWMutex
+	secrets []string
+	// Mask tells the runner of the workflow to hide a value, see
+	// https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions#masking-a-value-in-a-log.
+	Mask func(value string)
+}
+
+var Secrets = &SecretRegistry{Mask: maskInWorkflow}
+
+// workflowCommands is stdout before it is redacted, since masking a secret has to print it.
+var workflowCommands io.Writer = os.Stdout
+
+// flushRedaction writes what is left of the redacted output, see SetupRedaction.
+var flushRedaction = func() {}
+
+// SetupRedaction registers the secrets in the environment, and redacts every secret from the log
+// and from stdout of the command from then on. It is called at the start of main, and Exit
+// flushes the redacted output.
+func SetupRedaction() error {
+	for _, key := range secretEnvKeys {
+		Secrets.Add(os.Getenv(key))
+	}
+
+	// Anything can write to os.Stdout (e.g. fmt.Println), so it is replaced with a pipe that is
+	// redacted on its way to the original stdout.
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("could not redact stdout: %w", err)
+	}
+
+	stdout, stderr := os.Stdout, NewRedactingWriter(os.Stderr)
+	redactedStdout := NewRedactingWriter(stdout)
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		io.Copy(redactedStdout, reader)
+		redactedStdout.Flush()
+	}()
+
+	os.Stdout = writer
+	log.SetOutput(stderr)
+	var flushOnce sync.Once
+	flushRedaction = func() {
+		flushOnce.Do(func() {
+			os.Stdout = stdout
+			writer.Close()
+			<-copied
+			stderr.Flush()
+		})
+	}
+
+	return nil
+}
+
+func maskInWorkflow(value string) {
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		fmt.Fprintf(workflowCommands, "::add-mask::%s\n", value)
+	}
+}
+
+// Add registers a secret. The lines of multi-line secrets, e.g. private keys, are registered on
+// their own too, since the runner of the workflow masks line by line.
+func (registry *SecretRegistry) Add(secret string) {
+	var values []string
+	for _, line := range append(strings.Split(secret, "\n"), secret) {
+		line = strings.TrimSpace(line)
+		if len(line) < minSecretLength {
+			continue
+		}
+
+		values = append(values,
+			line,
+			base64.StdEncoding.EncodeToString([]byte(line)),
+			base64.StdEncoding.EncodeToString([]byte("x-access-token:"+line)),
+			url.QueryEscape(line),
+			url.PathEscape(line),
+		)
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	for _, value := range values {
+		if slices.Contains(registry.secrets, value) {
+			continue
+		}
+
+		registry.secrets = append(registry.secrets, value)
+		if registry.Mask != nil && !strings.Contains(value, "\n") {
+			registry.Mask(value)
+		}
+	}
+
+	// Longer values go first, so that a secret is not partially replaced by a line of itself.
+	slices.SortFunc(registry.secrets, func(a string, b string) int {
+		return len(b) - len(a)
+	})
+}
+
+func (registry *SecretRegistry) Redact(text string) string {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	for _, secret := range registry.secrets {
+		text = strings.ReplaceAll(text, secret, "<redacted>")
+	}
+
+	return text
+}
+
+// RedactingWriter redacts whole lines, so that secrets that are split over multiple writes are
+// redacted too. Flush writes what is left of the last line.
+type RedactingWriter struct {
+	writer  io.Writer
+	mutex   sync.Mutex
+	pending []byte
+}
+
+func NewRedactingWriter(writer io.Writer) *RedactingWriter {
+	return &RedactingWriter{writer: writer}
+}
+
+func (writer *RedactingWriter) Write(contents []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.pending = append(writer.pending, contents...)
+	lastLineBreak := bytes.LastIndexByte(writer.pending, '\n')
+	if lastLineBreak == -1 {
+		return len(contents), nil
+	}
+
+	lines := string(writer.pending[:lastLineBreak+1])
+	writer.pending = append([]byte{}, writer.pending[lastLineBreak+1:]...)
+	if _, err := io.WriteString(writer.writer, Secrets.Redact(lines)); err != nil {
+		return 0, err
+	}
+
+	return len(contents), nil
+}
+
+func (writer *RedactingWriter) Flush() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if len(writer.pending) == 0 {
+		return nil
+	}
+
+	_, err := io.WriteString(writer.writer, Secrets.Redact(string(writer.pending)))
+	writer.pending = nil
+	return err
+}
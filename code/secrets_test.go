@@ -0,0 +1,71 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactingWriter(t *testing.T) {
+	Secrets.Add("split-secret-value")
+
+	var output bytes.Buffer
+	writer := NewRedactingWriter(&output)
+	for _, part := range []string{"token: split-", "secret", "-value\nnext: split-secret-", "value"} {
+		if _, err := writer.Write([]byte(part)); err != nil {
+			t.Fatalf("Write() returned an error: %v", err)
+		}
+	}
+
+	if output.String() != "token: <redacted>\n" {
+		t.Errorf("RedactingWriter wrote %q before flushing, expected only the complete line", output.String())
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Flush() returned an error: %v", err)
+	}
+	if output.String() != "token: <redacted>\nnext: <redacted>" {
+		t.Errorf("RedactingWriter wrote %q", output.String())
+	}
+}
+
+func TestSetupRedaction(t *testing.T) {
+	t.Setenv("GITHUB_ACTIONS", "")
+	t.Setenv("GH_PAT_MF", "ghp_stdout-secret-from-env")
+
+	stdoutPath := filepath.Join(t.TempDir(), "stdout")
+	stdoutFile, err := os.Create(stdoutPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdoutFile.Close()
+
+	stdout := os.Stdout
+	os.Stdout = stdoutFile
+	defer func() {
+		os.Stdout = stdout
+		log.SetOutput(os.Stderr)
+		flushRedaction = func() {}
+	}()
+
+	if err := SetupRedaction(); err != nil {
+		t.Fatalf("SetupRedaction() returned an error: %v", err)
+	}
+	fmt.Println("token: ghp_stdout-secret-from-env")
+	fmt.Print("unterminated: ghp_stdout-secret-from-env")
+	flushRedaction()
+
+	contents, err := ReadFile(stdoutPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(contents, "ghp_stdout-secret-from-env") || contents != "token: <redacted>\nunterminated: <redacted>" {
+		t.Errorf("stdout contains %q, expected the secret from the environment to be redacted", contents)
+	}
+	if os.Stdout != stdoutFile {
+		t.Errorf("flushing did not restore stdout")
+	}
+}
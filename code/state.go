@@ -0,0 +1,106 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Every target has its own tag on the commit of the source repository it was last synced from,
+// so a target that fails to sync does not hold back the others. The message of the tag is the
+// version the target was synced to.
+const LastSyncedTagPrefix = "last-synced/"
+
+// legacyLastSyncedTag was shared by all targets, and has to be deleted before tags can be created
+// below it.
+const legacyLastSyncedTag = "last-synced"
+
+func LastSyncedTag(repository string) string {
+	return LastSyncedTagPrefix + repository
+}
+
+// GetReasonToSync explains why target is behind versionTag, i.e. why it has to be synced. It is
+// empty when the target was last synced to the same version, and neither the files synced to the
+// target nor its definition in the manifest changed since.
+func (repo *Repo) GetReasonToSync(target SyncTarget, versionTag string, tagCommits map[string]string) (string, error) {
+	if target.Version != "" {
+		versionTag = target.Version
+	}
+
+	lastSyncedTag := LastSyncedTag(target.Repository)
+	if _, hasEverSynced := tagCommits[lastSyncedTag]; !hasEverSynced {
+		return fmt.Sprintf("no `%s` tag exists yet", lastSyncedTag), nil
+	}
+
+	lastSyncedVersion, err := repo.GetTagMessage(lastSyncedTag)
+	if errors.Is(err, ErrTagNotFound) {
+		return fmt.Sprintf("the `%s` tag was not fetched", lastSyncedTag), nil
+	} else if err != nil {
+		return "", err
+	}
+	if lastSyncedVersion != versionTag {
+		return fmt.Sprintf("it was last synced to `%s` instead of `%s`", lastSyncedVersion, versionTag), nil
+	}
+
+	changes, err := repo.GetChangesSince(lastSyncedTag)
+	if err != nil {
+		return "", err
+	}
+
+	var changedFiles []string
+	for _, change := range changes {
+		if target.IsSynced(change.Path) {
+			changedFiles = append(changedFiles, change.Path)
+		}
+	}
+
+	if !repo.isTargetUnchangedSince(target, lastSyncedTag) {
+		changedFiles = append(changedFiles, ManifestPath)
+	}
+
+	if len(changedFiles) == 0 {
+		return "", nil
+	}
+
+	wereOrWas := "were"
+	if len(changedFiles) == 1 {
+		wereOrWas = "was"
+	}
+
+	return fmt.Sprintf("`%s` %s different since `%s`", strings.Join(changedFiles, "`, `"), wereOrWas, lastSyncedTag), nil
+}
+
+// isTargetUnchangedSince compares the definition of the target with its definition in the
+// manifest at tag, so that changes to other targets do not count.
+func (repo *Repo) isTargetUnchangedSince(target SyncTarget, tag string) bool {
+	manifestContents, err := repo.GetFileAt(tag, ManifestPath)
+	if err != nil {
+		return false
+	}
+
+	manifest, err := ParseManifest(manifestContents)
+	if err != nil {
+		return false
+	}
+
+	previousTarget := manifest.Target(target.Repository)
+	return previousTarget != nil && reflect.DeepEqual(*previousTarget, target)
+}
+
+// UpdateLastSynced moves the tags of the synced repositories to the latest commit, recording the
+// version each of them was synced to.
+func (repo *Repo) UpdateLastSynced(syncedVersions map[string]string, tagCommits map[string]string) error {
+	if _, exists := tagCommits[legacyLastSyncedTag]; exists {
+		if err := repo.DeleteTag(legacyLastSyncedTag); err != nil {
+			return fmt.Errorf("could not delete legacy tag '%s': %w", legacyLastSyncedTag, err)
+		}
+	}
+
+	tagMessages := map[string]string{}
+	for repository, versionTag := range syncedVersions {
+		tagMessages[LastSyncedTag(repository)] = versionTag
+	}
+
+	return repo.MoveTags(tagMessages)
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	gogithub "github.com/google/go-github/v62/github"
@@ -15,31 +16,57 @@ import (
 )
 
 type SyncedRepository struct {
-	Identifier  string
-	Error       error
-	ElapsedTime time.Duration
-	PullRequest *gogithub.PullRequest
+	Identifier     string
+	Error          error
+	ElapsedTime    time.Duration
+	PullRequest    *gogithub.PullRequest
+	Merged         bool
+	MergeScheduled bool
+	FailingChecks  []common.CheckResult
 }
 
-func getTargetRepos() []string {
-	reposJsonPath := "repos.json"
-	reposJson, err := common.ReadFile(reposJsonPath)
+func getManifest() (*common.Manifest, error) {
+	manifest, err := common.LoadManifest(common.ManifestPath)
 	if err != nil {
-		panic(fmt.Errorf("could not read '%s': %v", reposJsonPath, err))
+		return nil, err
 	}
 
-	var repos []string
-	err = json.Unmarshal([]byte(reposJson), &repos)
-	if err != nil {
-		panic(fmt.Errorf("could not parse '%s', expected a JSON formatted list of strings: %v", reposJsonPath, err))
+	for _, target := range manifest.Targets() {
+		if !target.IsEnabled() {
+			log.Printf("Skipping '%s', it is disabled in '%s'.\n", target.Repository, common.ManifestPath)
+		}
+	}
+
+	return manifest, nil
+}
+
+// getConfigNeeds only asks for the approver when a target wants its pull requests approved, and
+// for the workflow run when pull requests are opened.
+func getConfigNeeds(targets []common.SyncTarget, readOnly bool) []common.ConfigNeed {
+	needs := []common.ConfigNeed{common.NeedsAuth}
+	if readOnly {
+		return needs
 	}
 
-	return repos
+	needs = append(needs, common.NeedsWorkflowRun)
+	if slices.ContainsFunc(targets, func(target common.SyncTarget) bool { return target.Merge.ShouldApprove() }) {
+		needs = append(needs, common.NeedsApprover)
+	}
+
+	return needs
+}
+
+func formatRepo(config *common.Config, syncedRepo SyncedRepository) string {
+	return formatRepoIdentifier(config, syncedRepo.Identifier)
 }
 
-func formatRepo(syncedRepo SyncedRepository) string {
-	_, name := common.RepoOwnerName(syncedRepo.Identifier)
-	return fmt.Sprintf("**[`%s`](https://github.com/%s)**", name, syncedRepo.Identifier)
+func formatRepoIdentifier(config *common.Config, identifier string) string {
+	_, name, err := common.RepoOwnerName(identifier)
+	if err != nil {
+		name = identifier
+	}
+
+	return fmt.Sprintf("**[`%s`](%s)**", name, common.RepositoryURL(config.Host, identifier))
 }
 
 func formatSuccess(syncedRepo SyncedRepository) string {
@@ -56,7 +83,7 @@ func formatPullRequestStatus(syncedRepo SyncedRepository) string {
 
 	format := "<img align=\"center\" src=\"%s\"/>"
 
-	if syncedRepo.Error != nil {
+	if !syncedRepo.Merged {
 		return fmt.Sprintf(format, openImageUrl)
 	}
 
@@ -67,6 +94,9 @@ func formatPullRequest(syncedRepo SyncedRepository) string {
 	pullRequestString := "No changes needed."
 	if syncedRepo.PullRequest != nil {
 		pullRequestString = fmt.Sprintf("%s [**%s**](%s) #%v", formatPullRequestStatus(syncedRepo), *syncedRepo.PullRequest.Title, *syncedRepo.PullRequest.HTMLURL, *syncedRepo.PullRequest.Number)
+		if syncedRepo.MergeScheduled {
+			pullRequestString += " (merged by GitHub once it can be)"
+		}
 	} else if syncedRepo.Error != nil {
 		pullRequestString = "Could not create."
 	}
@@ -74,11 +104,24 @@ func formatPullRequest(syncedRepo SyncedRepository) string {
 	return fmt.Sprintf("<ul><li>%s</li></ul>", pullRequestString)
 }
 
+func formatCheck(check common.CheckResult) string {
+	checkString := fmt.Sprintf("`%s` (%s)", check.Name, check.Detail)
+	if check.URL != "" {
+		checkString = fmt.Sprintf("[`%s`](%s) (%s)", check.Name, check.URL, check.Detail)
+	}
+
+	if check.State == common.CheckPending {
+		return fmt.Sprintf("  - ⏳ %s", checkString)
+	}
+
+	return fmt.Sprintf("  - ❌ %s", checkString)
+}
+
 func formatTime(syncedRepo SyncedRepository) string {
 	return syncedRepo.ElapsedTime.Round(time.Second).String()
 }
 
-func GetSyncedReposTableAndErrors(syncedRepos []SyncedRepository) string {
+func GetSyncedReposTableAndErrors(config *common.Config, syncedRepos []SyncedRepository) string {
 	var syncedReposTable []string
 	var syncedReposErrors []string
 
@@ -86,13 +129,16 @@ func GetSyncedReposTableAndErrors(syncedRepos []SyncedRepository) string {
 	syncedReposTable = append(syncedReposTable, "|:-|:-:|:-|-:|")
 
 	for _, syncedRepo := range syncedRepos {
-		syncedReposTable = append(syncedReposTable, fmt.Sprintf("| %s | %s | %s | %s |", formatRepo(syncedRepo), formatSuccess(syncedRepo), formatPullRequest(syncedRepo), formatTime(syncedRepo)))
+		syncedReposTable = append(syncedReposTable, fmt.Sprintf("| %s | %s | %s | %s |", formatRepo(config, syncedRepo), formatSuccess(syncedRepo), formatPullRequest(syncedRepo), formatTime(syncedRepo)))
 
 		if syncedRepo.Error != nil {
 			newlinePattern := regexp.MustCompile(`\r\n|[\r\n\v\f\x{0085}\x{2028}\x{2029}]`)
 			errorString := newlinePattern.ReplaceAllString(syncedRepo.Error.Error(), "; ")
 
-			syncedReposErrors = append(syncedReposErrors, fmt.Sprintf("- ❌ %s (%s)", formatRepo(syncedRepo), errorString))
+			syncedReposErrors = append(syncedReposErrors, fmt.Sprintf("- ❌ %s (%s)", formatRepo(config, syncedRepo), errorString))
+			for _, check := range syncedRepo.FailingChecks {
+				syncedReposErrors = append(syncedReposErrors, formatCheck(check))
+			}
 		}
 	}
 
@@ -126,77 +172,458 @@ func GetSyncedRepoCount(syncedRepos []SyncedRepository) (int, int) {
 	return successfulRepos, len(syncedRepos)
 }
 
-func updateLastSynced(dir string) {
-	err := common.ExecInDir(dir, func() error {
-		common.SetupGitHubUser()
-		if err := common.SetOrigin("workflow-sync-poc/common"); err != nil {
-			return err
+func updateLastSynced(config *common.Config, repo *common.Repo, syncedVersions map[string]string, tagCommits map[string]string) error {
+	if err := repo.SetupGitHubUser(config.GitUser); err != nil {
+		return err
+	}
+
+	if err := repo.SetOrigin(config.SourceRepository); err != nil {
+		return err
+	}
+
+	return repo.UpdateLastSynced(syncedVersions, tagCommits)
+}
+
+// getTargetsBehind leaves out the targets that are up to date with their `last-synced/` tag.
+func getTargetsBehind(repo *common.Repo, targets []common.SyncTarget, versionTag string, tagCommits map[string]string) ([]common.SyncTarget, error) {
+	var targetsBehind []common.SyncTarget
+	for _, target := range targets {
+		reasonToSync, err := repo.GetReasonToSync(target, versionTag, tagCommits)
+		if err != nil {
+			return nil, err
 		}
 
-		if err := common.AddOrMoveTag("last-synced"); err != nil {
-			return err
+		if reasonToSync == "" {
+			log.Printf("Skipping '%s', it is up to date with '%s'.\n", target.Repository, common.LastSyncedTag(target.Repository))
+			continue
 		}
 
-		return nil
-	})
+		log.Printf("Syncing '%s', because %s.\n", target.Repository, reasonToSync)
+		targetsBehind = append(targetsBehind, target)
+	}
+
+	return targetsBehind, nil
+}
 
+// getFailedTargets only keeps the targets that failed in the recorded run, along with that run.
+func getFailedTargets(api common.GitHubAPI, sourceRepo string, targets []common.SyncTarget) (*common.RunRecord, []common.SyncTarget, error) {
+	failedRun, err := common.LoadRunRecord(api, sourceRepo)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
+	}
+	if failedRun == nil {
+		return nil, nil, fmt.Errorf("could not retry failed repositories, no run was recorded on branch '%s' yet: %w", common.RunRecordBranch, common.ErrBranchNotFound)
+	}
+
+	var failedTargets []common.SyncTarget
+	for _, failed := range failedRun.Failed() {
+		index := slices.IndexFunc(targets, func(target common.SyncTarget) bool {
+			return strings.EqualFold(target.Repository, failed.Repository)
+		})
+		if index < 0 {
+			log.Printf("Skipping '%s', it is no longer enabled in '%s'.\n", failed.Repository, common.ManifestPath)
+			continue
+		}
+
+		log.Printf("Retrying '%s', it failed in run #%v: %s\n", failed.Repository, failedRun.RunNumber, failed.Error)
+		failedTargets = append(failedTargets, targets[index])
 	}
+
+	return failedRun, failedTargets, nil
 }
 
-func main() {
+func saveRunRecord(config *common.Config, api common.GitHubAPI, sourceRepo string, syncedRepos []SyncedRepository, versionTag string) error {
+	workflowRun, err := common.GetCurrentWorkflowRun(api, config)
+	if err != nil {
+		return err
+	}
+
+	record := common.NewRunRecord(workflowRun, versionTag)
+	for _, syncedRepo := range syncedRepos {
+		record.Add(syncedRepo.Identifier, syncedRepo.Error)
+	}
+
+	return common.SaveRunRecord(api, sourceRepo, record)
+}
+
+func forEachTarget(targets []common.SyncTarget, concurrency int, do func(int, common.SyncTarget)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	indices := make(chan int)
+	var waitGroup sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for index := range indices {
+				do(index, targets[index])
+			}
+		}()
+	}
+
+	for index := range targets {
+		indices <- index
+	}
+	close(indices)
+
+	waitGroup.Wait()
+}
+
+func createWorkspace(workspace string) (string, error) {
+	if workspace != "" {
+		if err := common.CreateDirectory(workspace); err != nil {
+			return "", err
+		}
+		return workspace, nil
+	}
+
+	workspace, err := os.MkdirTemp("", "sync-workflows-")
+	if err != nil {
+		return "", fmt.Errorf("could not create workspace: %w", err)
+	}
+
+	return workspace, nil
+}
+
+func countChanges(plan common.RepositoryPlan, status string) int {
+	count := 0
+	for _, change := range plan.Changes {
+		if change.Status == status {
+			count += 1
+		}
+	}
+
+	return count
+}
+
+func GetPlansTableAndDiffs(config *common.Config, plans []common.RepositoryPlan) string {
+	var plansTable []string
+	var plansDiffs []string
+
+	plansTable = append(plansTable, "| Repository | Added | Removed | Modified |")
+	plansTable = append(plansTable, "|:-|-:|-:|-:|")
+
+	for _, plan := range plans {
+		if plan.Error != "" {
+			plansTable = append(plansTable, fmt.Sprintf("| %s | ❌ | ❌ | ❌ |", formatRepoIdentifier(config, plan.Repository)))
+			plansDiffs = append(plansDiffs, fmt.Sprintf("- ❌ %s (%s)", formatRepoIdentifier(config, plan.Repository), plan.Error))
+			continue
+		}
+
+		plansTable = append(plansTable, fmt.Sprintf("| %s | %v | %v | %v |", formatRepoIdentifier(config, plan.Repository), countChanges(plan, "added"), countChanges(plan, "removed"), countChanges(plan, "modified")))
+
+		if plan.HasChanges() {
+			plansDiffs = append(plansDiffs, fmt.Sprintf("<details><summary>%s</summary>\r\n\r\n```diff\r\n%s\r\n```\r\n</details>", formatRepoIdentifier(config, plan.Repository), strings.TrimSuffix(plan.Diff, "\n")))
+		}
+	}
+
+	var tableAndDiffsLines []string
+	tableAndDiffsLines = append(tableAndDiffsLines, strings.Join(plansTable, "\r\n"))
+	if len(plansDiffs) > 0 {
+		tableAndDiffsLines = append(tableAndDiffsLines, strings.Join(plansDiffs, "\r\n"))
+	}
+
+	return strings.Join(tableAndDiffsLines, "\r\n")
+}
+
+func planTargets(syncer *common.Syncer, targets []common.SyncTarget, versionTag string, planPath string, concurrency int) error {
+	plans := make([]common.RepositoryPlan, len(targets))
+	forEachTarget(targets, concurrency, func(index int, target common.SyncTarget) {
+		plan, err := syncer.PlanRepository(target, versionTag)
+		if err != nil {
+			log.Printf("Failed to plan sync to '%s': %v\n", target.Repository, err)
+			plan = &common.RepositoryPlan{Repository: target.Repository, Error: err.Error()}
+		}
+
+		plans[index] = *plan
+	})
+
+	changedCount := 0
+	failedCount := 0
+	for _, plan := range plans {
+		if plan.Error != "" {
+			failedCount += 1
+		} else if plan.HasChanges() {
+			changedCount += 1
+		}
+	}
+
+	if err := common.WritePlans(planPath, plans); err != nil {
+		return err
+	}
+
+	var summaryLines []string
+	summaryLines = append(summaryLines, fmt.Sprintf("### 🔍 Planned `%s` Workflows for `%v/%v` Repos", versionTag, changedCount, len(targets)))
+	summaryLines = append(summaryLines, GetPlansTableAndDiffs(syncer.Config, plans))
+	summaryLines = append(summaryLines, fmt.Sprintf("*Nothing was pushed, the plan was also written to `%s`.*", planPath))
+
+	if retrySummary := common.Retries.Summary(); retrySummary != "" {
+		summaryLines = append(summaryLines, retrySummary)
+	}
+
+	if err := common.WriteJobSummary(syncer.Config, strings.Join(summaryLines, "\r\n")); err != nil {
+		return err
+	}
+
+	if failedCount > 0 {
+		return fmt.Errorf("%v/%v repositories could not be planned: %w", failedCount, len(targets), common.ErrRepositoriesFailed)
+	}
+
+	return nil
+}
+
+func countDrift(drift common.RepositoryDrift, status string) int {
+	count := 0
+	for _, file := range drift.Files {
+		if file.Status == status {
+			count += 1
+		}
+	}
+
+	return count
+}
+
+func GetDriftTableAndFiles(config *common.Config, drifts []common.RepositoryDrift) string {
+	var driftTable []string
+	var driftFiles []string
+
+	driftTable = append(driftTable, "| Repository | Missing | Modified | Extra |")
+	driftTable = append(driftTable, "|:-|-:|-:|-:|")
+
+	for _, drift := range drifts {
+		if drift.Error != "" {
+			driftTable = append(driftTable, fmt.Sprintf("| %s | ❌ | ❌ | ❌ |", formatRepoIdentifier(config, drift.Repository)))
+			driftFiles = append(driftFiles, fmt.Sprintf("- ❌ %s (%s)", formatRepoIdentifier(config, drift.Repository), drift.Error))
+			continue
+		}
+
+		driftTable = append(driftTable, fmt.Sprintf("| %s | %v | %v | %v |", formatRepoIdentifier(config, drift.Repository), countDrift(drift, common.DriftMissing), countDrift(drift, common.DriftModified), countDrift(drift, common.DriftExtra)))
+
+		if drift.HasDrift() {
+			driftFiles = append(driftFiles, fmt.Sprintf("- %s", formatRepoIdentifier(config, drift.Repository)))
+			for _, file := range drift.Files {
+				driftFiles = append(driftFiles, fmt.Sprintf("  - `%s` is %s", file.Path, file.Status))
+			}
+		}
+	}
+
+	var tableAndFilesLines []string
+	tableAndFilesLines = append(tableAndFilesLines, strings.Join(driftTable, "\r\n"))
+	if len(driftFiles) > 0 {
+		tableAndFilesLines = append(tableAndFilesLines, strings.Join(driftFiles, "\r\n"))
+	}
+
+	return strings.Join(tableAndFilesLines, "\r\n")
+}
+
+// detectDrift reports the repositories whose managed files no longer match versionTag, and with
+// fix, syncs those repositories again to open pull requests that undo the drift. Those pull
+// requests are neither approved nor merged, so someone can review what is undone.
+func detectDrift(syncer *common.Syncer, targets []common.SyncTarget, versionTag string, driftPath string, concurrency int, fix bool) error {
+	drifts := make([]common.RepositoryDrift, len(targets))
+	forEachTarget(targets, concurrency, func(index int, target common.SyncTarget) {
+		drift, err := syncer.DetectDrift(target, versionTag)
+		if err != nil {
+			log.Printf("Failed to detect drift in '%s': %v\n", target.Repository, err)
+			drift = &common.RepositoryDrift{Repository: target.Repository, Error: err.Error()}
+		}
+
+		drifts[index] = *drift
+	})
+
+	var driftedTargets []common.SyncTarget
+	failedCount := 0
+	for index, drift := range drifts {
+		if drift.Error != "" {
+			failedCount += 1
+		} else if drift.HasDrift() {
+			driftedTargets = append(driftedTargets, targets[index])
+		}
+	}
+
+	if err := common.WriteDriftReport(driftPath, drifts); err != nil {
+		return err
+	}
+
+	var summaryLines []string
+	summaryLines = append(summaryLines, fmt.Sprintf("### 🧭 Drifted from `%s` Workflows in `%v/%v` Repos", versionTag, len(driftedTargets), len(targets)))
+	summaryLines = append(summaryLines, GetDriftTableAndFiles(syncer.Config, drifts))
+	summaryLines = append(summaryLines, fmt.Sprintf("*The drift report was also written to `%s`.*", driftPath))
+
+	if fix && len(driftedTargets) > 0 {
+		startTime := time.Now()
+		syncedRepos := make([]SyncedRepository, len(driftedTargets))
+		forEachTarget(driftedTargets, concurrency, func(index int, target common.SyncTarget) {
+			target.Merge = common.MergeConfig{Mode: common.MergeModeNone}
+			result, err := syncer.SyncRepository(target, versionTag)
+			if err != nil {
+				log.Printf("Failed to fix drift in '%s': %v\n", target.Repository, err)
+			}
+
+			syncedRepos[index] = SyncedRepository{
+				Identifier:     target.Repository,
+				Error:          err,
+				ElapsedTime:    time.Since(startTime),
+				PullRequest:    result.PullRequest,
+				Merged:         result.Merged,
+				MergeScheduled: result.MergeScheduled,
+				FailingChecks:  result.FailingChecks,
+			}
+		})
+
+		successCount, totalCount := GetSyncedRepoCount(syncedRepos)
+		failedCount += totalCount - successCount
+
+		summaryLines = append(summaryLines, fmt.Sprintf("### 🩹 Fixed Drift in `%v/%v` Repos", successCount, totalCount))
+		summaryLines = append(summaryLines, GetSyncedReposTableAndErrors(syncer.Config, syncedRepos))
+	}
+
+	if retrySummary := common.Retries.Summary(); retrySummary != "" {
+		summaryLines = append(summaryLines, retrySummary)
+	}
+
+	if err := common.WriteJobSummary(syncer.Config, strings.Join(summaryLines, "\r\n")); err != nil {
+		return err
+	}
+
+	if failedCount > 0 {
+		return fmt.Errorf("%v repositories could not be checked or fixed for drift: %w", failedCount, common.ErrRepositoriesFailed)
+	}
+
+	return nil
+}
+
+type syncOptions struct {
+	plan        bool
+	planPath    string
+	concurrency int
+	all         bool
+	workspace   string
+	drift       bool
+	driftPath   string
+	fix         bool
+	retryFailed bool
+}
+
+func syncWorkflows(config *common.Config, manifest *common.Manifest, options syncOptions) error {
 	workingDirectory, err := os.Getwd()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	sourceRepo, err := common.GetCurrentRepository()
+	workingRepo := common.OpenRepo(config, workingDirectory)
+	if config.SourceRepository == "" {
+		if config.SourceRepository, err = workingRepo.GetCurrentRepository(); err != nil {
+			return err
+		}
+	}
+	sourceRepo := config.SourceRepository
+
+	latestVersion, latestTag, err := workingRepo.GetLatestVersion(sourceRepo)
+	if err != nil {
+		return err
+	}
+	if latestTag == "" {
+		return fmt.Errorf("could not get latest version tag of '%s': %w", sourceRepo, common.ErrTagNotFound)
+	}
+
+	// Consumers follow the floating major tag, so they pick up minor and patch releases as well.
+	// The lockfile of every target records the release and commit it points to.
+	versionTag := latestVersion.MajorTag()
+	log.Printf("Syncing '%s' (latest release '%s') of '%s'...\n", versionTag, latestTag, sourceRepo)
+
+	sourceCommits, err := workingRepo.GetTagCommits()
+	if err != nil {
+		return err
+	}
+
+	if err := manifest.ValidateVersions(sourceCommits); err != nil {
+		return fmt.Errorf("%w: manifest '%s': %w", common.ErrInvalidConfig, common.ManifestPath, err)
+	}
+	targets := manifest.EnabledTargets()
+
+	workspace, err := createWorkspace(options.workspace)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	versionTag, err := common.GetLatestVersionTag(sourceRepo)
+	syncer, err := common.NewSyncer(config, workspace, sourceRepo, workingDirectory, sourceCommits)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if options.plan {
+		return planTargets(syncer, targets, versionTag, options.planPath, options.concurrency)
 	}
-	if versionTag == "" {
-		panic(fmt.Errorf("could not get latest version tag, it returned \"\""))
+	if options.drift {
+		return detectDrift(syncer, targets, versionTag, options.driftPath, options.concurrency, options.fix)
+	}
+
+	enabledCount := len(targets)
+	var failedRun *common.RunRecord
+	if options.retryFailed {
+		if failedRun, targets, err = getFailedTargets(syncer.GitHub, sourceRepo, targets); err != nil {
+			return err
+		}
+	} else if !options.all {
+		if targets, err = getTargetsBehind(workingRepo, targets, versionTag, sourceCommits); err != nil {
+			return err
+		}
 	}
 
 	startTime := time.Now()
-	syncedRepos := []SyncedRepository{}
-	targetRepos := getTargetRepos()
+	syncedRepos := make([]SyncedRepository, len(targets))
 
-	for _, targetRepo := range targetRepos {
-		pullRequest, err := common.SyncRepository(targetRepo, versionTag)
+	// Every worker writes to its own index, so the report keeps the order of the manifest.
+	forEachTarget(targets, options.concurrency, func(index int, target common.SyncTarget) {
+		result, err := syncer.SyncRepository(target, versionTag)
 		if err != nil {
-			log.Printf("Failed to sync to '%s': %v\n", targetRepo, err)
+			log.Printf("Failed to sync to '%s': %v\n", target.Repository, err)
 		}
 
-		syncedRepository := SyncedRepository{
-			Identifier:  targetRepo,
-			Error:       err,
-			ElapsedTime: time.Since(startTime),
-			PullRequest: pullRequest,
+		syncedRepos[index] = SyncedRepository{
+			Identifier:     target.Repository,
+			Error:          err,
+			ElapsedTime:    time.Since(startTime),
+			PullRequest:    result.PullRequest,
+			Merged:         result.Merged,
+			MergeScheduled: result.MergeScheduled,
+			FailingChecks:  result.FailingChecks,
 		}
-
-		syncedRepos = append(syncedRepos, syncedRepository)
-	}
+	})
 
 	var summaryLines []string
 	successCount, totalCount := GetSyncedRepoCount(syncedRepos)
-	tableAndErrors := GetSyncedReposTableAndErrors(syncedRepos)
+	tableAndErrors := GetSyncedReposTableAndErrors(config, syncedRepos)
 
 	summaryLines = append(summaryLines, fmt.Sprintf("### 💨 Pushed `%s` Workflows to `%v/%v` Repos", versionTag, successCount, totalCount))
 	summaryLines = append(summaryLines, tableAndErrors)
 
-	lastSyncedTag := "last-synced"
-	if successCount == totalCount {
-		updateLastSynced(workingDirectory)
-		summaryLines = append(summaryLines, fmt.Sprintf("### 🏷️ Tag `%s` Updated", lastSyncedTag))
-	} else {
-		missingCount := totalCount - successCount
+	if failedRun != nil {
+		summaryLines = append(summaryLines, fmt.Sprintf("*Only the `%v` repo(s) that failed in [run #%v](%s) were retried.*", totalCount, failedRun.RunNumber, failedRun.RunURL))
+	} else if skippedCount := enabledCount - totalCount; skippedCount > 0 {
+		summaryLines = append(summaryLines, fmt.Sprintf("*`%v` repo(s) were skipped, because they are up to date with their `%s` tag.*", skippedCount, common.LastSyncedTagPrefix))
+	}
+
+	syncedVersions := map[string]string{}
+	for index, syncedRepo := range syncedRepos {
+		if syncedRepo.Error == nil {
+			syncedVersions[syncedRepo.Identifier] = versionTag
+			if targets[index].Version != "" {
+				syncedVersions[syncedRepo.Identifier] = targets[index].Version
+			}
+		}
+	}
+	if err := updateLastSynced(config, workingRepo, syncedVersions, sourceCommits); err != nil {
+		return err
+	}
+	if err := saveRunRecord(config, syncer.GitHub, sourceRepo, syncedRepos, versionTag); err != nil {
+		return err
+	}
+	summaryLines = append(summaryLines, fmt.Sprintf("### 🏷️ Tags `%s` Updated for `%v/%v` Repos", common.LastSyncedTagPrefix, successCount, totalCount))
+
+	if missingCount := totalCount - successCount; missingCount > 0 {
 		repoPostfix := "s"
 		needPostfix := ""
 		if missingCount == 1 {
@@ -204,13 +631,60 @@ func main() {
 			needPostfix = "s"
 		}
 
-		summaryLines = append(summaryLines, fmt.Sprintf("### 🏷️ Tag `%s` Stays", lastSyncedTag))
-		summaryLines = append(summaryLines, fmt.Sprintf("*The next run will attempt to sync again, because **%v** repo%s still need%s workflows synced.*", missingCount, repoPostfix, needPostfix))
+		summaryLines = append(summaryLines, fmt.Sprintf("*The next run will attempt to sync again, because **%v** repo%s still need%s workflows synced. Run with `-retry-failed` to only sync those again.*", missingCount, repoPostfix, needPostfix))
+	}
+
+	if retrySummary := common.Retries.Summary(); retrySummary != "" {
+		summaryLines = append(summaryLines, retrySummary)
 	}
 
-	common.WriteJobSummary(strings.Join(summaryLines, "\r\n"))
+	if err := common.WriteJobSummary(config, strings.Join(summaryLines, "\r\n")); err != nil {
+		return err
+	}
 
 	if successCount < totalCount {
-		panic(errors.New("one or more repositories were not synced successfully"))
+		return fmt.Errorf("%v/%v repositories were not synced successfully: %w", totalCount-successCount, totalCount, common.ErrRepositoriesFailed)
 	}
+
+	return nil
+}
+
+func main() {
+	if err := common.SetupRedaction(); err != nil {
+		common.Exit(nil, "sync-workflows", err)
+	}
+
+	plan := flag.Bool("plan", false, "only show the changes each repository would receive, without pushing anything")
+	planPath := flag.String("plan-output", "sync-plan.json", "the file to write the plan to as JSON when using -plan")
+	concurrency := flag.Int("concurrency", 1, "the maximum number of repositories to sync at the same time, syncing several at once can hit the secondary rate limits of GitHub")
+	all := flag.Bool("all", false, "sync every repository, including those that are up to date with their last-synced tag")
+	workspace := flag.String("workspace", "", "the directory to clone repositories into, by default a temporary directory")
+	drift := flag.Bool("drift", false, "only report the repositories whose synced files were edited or deleted, without pushing anything")
+	driftPath := flag.String("drift-output", "drift-report.json", "the file to write the drift report to as JSON when using -drift")
+	fix := flag.Bool("fix", false, "with -drift, sync the repositories that drifted to open pull requests undoing the drift")
+	retryFailed := flag.Bool("retry-failed", false, "only sync the repositories that failed in the previous run")
+	configFlags := common.RegisterConfigFlags(flag.CommandLine)
+	flag.Parse()
+
+	manifest, err := getManifest()
+	if err != nil {
+		common.Exit(nil, "sync-workflows", err)
+	}
+
+	config, err := configFlags.Load(getConfigNeeds(manifest.EnabledTargets(), *plan || (*drift && !*fix))...)
+	if err != nil {
+		common.Exit(nil, "sync-workflows", err)
+	}
+
+	common.Exit(config, "sync-workflows", syncWorkflows(config, manifest, syncOptions{
+		plan:        *plan,
+		planPath:    *planPath,
+		concurrency: *concurrency,
+		all:         *all,
+		workspace:   *workspace,
+		drift:       *drift,
+		driftPath:   *driftPath,
+		fix:         *fix,
+		retryFailed: *retryFailed,
+	}))
 }
@@ -0,0 +1,325 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	gogithub "github.com/google/go-github/v62/github"
+)
+
+// Syncer syncs the files of Source to target repositories. The files are read from the clone of
+// Source in SourceDir at the tag a target is synced to. SourceCommits maps the tags of Source to
+// the commits they point to, which are recorded in the lockfile of every target.
+type Syncer struct {
+	Config        *Config
+	GitHub        GitHubAPI
+	Approver      GitHubAPI
+	Git           GitBackend
+	RemoteURL     func(repo string) string
+	Workspace     string
+	Source        string
+	SourceDir     string
+	SourceCommits map[string]string
+
+	sourceMutex sync.Mutex
+	sourceFiles map[string][]TreeFile
+}
+
+func NewSyncer(config *Config, workspace string, source string, sourceDir string, sourceCommits map[string]string) (*Syncer, error) {
+	client, err := newAuthenticatedClient(config.Host, config.Tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	approverClient, err := newAuthenticatedClient(config.Host, config.ApproverTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Syncer{
+		Config:        config,
+		GitHub:        NewGitHubClient(client),
+		Approver:      NewGitHubClient(approverClient),
+		Git:           config.GitBackend(),
+		RemoteURL:     config.RemoteURL,
+		Workspace:     workspace,
+		Source:        source,
+		SourceDir:     sourceDir,
+		SourceCommits: sourceCommits,
+	}, nil
+}
+
+func (syncer *Syncer) openRepo(dir string) *Repo {
+	return &Repo{Dir: dir, Backend: syncer.Git, RemoteURL: syncer.RemoteURL}
+}
+
+// sourceRef prefers the commit that the remote tag points to, in case the local tag is outdated.
+func (syncer *Syncer) sourceRef(versionTag string) string {
+	if commit, ok := syncer.SourceCommits[versionTag]; ok && commit != "" {
+		return commit
+	}
+
+	return "refs/tags/" + versionTag
+}
+
+// releaseTag returns the release that a floating tag points to (e.g. "v1.4.2" for "v1"), so that
+// the lockfile records exactly what was synced. Other tags are returned as they are.
+func (syncer *Syncer) releaseTag(versionTag string) string {
+	commit := syncer.SourceCommits[versionTag]
+	if commit == "" {
+		return versionTag
+	}
+
+	release, releaseVersion := versionTag, Version{}
+	for tag, tagCommit := range syncer.SourceCommits {
+		version, parts, ok := ParseVersion(tag)
+		if !ok || parts != 3 || tagCommit != commit || !strings.HasPrefix(tag, versionTag+".") {
+			continue
+		}
+
+		if release == versionTag || version.Compare(releaseVersion) > 0 {
+			release, releaseVersion = tag, version
+		}
+	}
+
+	return release
+}
+
+// listSourceFiles lists the files of Source at versionTag once, since every target that is synced
+// to the same version needs them.
+func (syncer *Syncer) listSourceFiles(versionTag string) ([]TreeFile, error) {
+	syncer.sourceMutex.Lock()
+	defer syncer.sourceMutex.Unlock()
+
+	if files, ok := syncer.sourceFiles[versionTag]; ok {
+		return files, nil
+	}
+
+	files, err := syncer.Git.ListFiles(syncer.SourceDir, syncer.sourceRef(versionTag))
+	if err != nil && isUnknownRevision(err) {
+		return nil, fmt.Errorf("could not list files of '%s' at '%s': %w: %w", syncer.Source, versionTag, ErrTagNotFound, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("could not list files of '%s' at '%s': %w", syncer.Source, versionTag, err)
+	}
+
+	if syncer.sourceFiles == nil {
+		syncer.sourceFiles = map[string][]TreeFile{}
+	}
+	syncer.sourceFiles[versionTag] = files
+
+	return files, nil
+}
+
+func (syncer *Syncer) readSourceFile(versionTag string, filePath string) (string, error) {
+	contents, err := syncer.Git.ShowFile(syncer.SourceDir, syncer.sourceRef(versionTag), filePath)
+	if err != nil {
+		return "", fmt.Errorf("could not read '%s' at '%s': %w", filePath, versionTag, err)
+	}
+
+	return contents, nil
+}
+
+func (syncer *Syncer) getTargetRepoDir(target SyncTarget) (string, error) {
+	owner, name, err := RepoOwnerName(target.Repository)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(syncer.Workspace, owner, name), nil
+}
+
+func (syncer *Syncer) resolveSync(target SyncTarget, versionTag string) (string, string, error) {
+	if target.Version != "" {
+		versionTag = target.Version
+	}
+
+	baseBranch := target.BaseBranch
+	if baseBranch == "" {
+		owner, name, err := RepoOwnerName(target.Repository)
+		if err != nil {
+			return "", "", err
+		}
+
+		defaultBranch, err := GetDefaultBranch(syncer.GitHub, owner, name)
+		if err != nil {
+			return "", "", err
+		}
+		baseBranch = defaultBranch
+	}
+
+	return baseBranch, versionTag, nil
+}
+
+func (syncer *Syncer) locallySync(target SyncTarget, baseBranch string, versionTag string) (*Repo, []string, error) {
+	repo, err := syncer.cloneTarget(target, baseBranch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changedPaths, err := syncer.applyFileSets(repo, target, baseBranch, versionTag)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return repo, changedPaths, nil
+}
+
+func (syncer *Syncer) cloneTarget(target SyncTarget, baseBranch string) (*Repo, error) {
+	repoDir, err := syncer.getTargetRepoDir(target)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := syncer.openRepo(repoDir)
+	if err := repo.Clone(target.Repository, baseBranch); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+type SyncResult struct {
+	PullRequest    *gogithub.PullRequest
+	Merged         bool
+	MergeScheduled bool
+	FailingChecks  []CheckResult
+}
+
+func (syncer *Syncer) SyncRepository(target SyncTarget, versionTag string) (*SyncResult, error) {
+	result := &SyncResult{}
+	targetOwner, targetName, err := RepoOwnerName(target.Repository)
+	if err != nil {
+		return result, err
+	}
+
+	baseBranch, versionTag, err := syncer.resolveSync(target, versionTag)
+	if err != nil {
+		return result, err
+	}
+
+	repo, err := syncer.cloneTarget(target, baseBranch)
+	if err != nil {
+		return result, fmt.Errorf("could not sync locally: %w", err)
+	}
+
+	featureBranch := target.Branch
+	if err := repo.SetupGitHubUser(syncer.Config.GitUser); err != nil {
+		return result, err
+	}
+
+	pullRequest, err := FindOpenPullRequest(syncer.GitHub, targetOwner, targetName, featureBranch, baseBranch)
+	if err != nil {
+		return result, err
+	}
+	result.PullRequest = pullRequest
+	if pullRequest != nil {
+		// Add to the branch of the open pull request instead of recreating it, which would close
+		// the pull request and lose its reviews.
+		if err := repo.CheckoutExistingBranch(featureBranch); err != nil {
+			return result, err
+		}
+	}
+
+	changedPaths, err := syncer.applyFileSets(repo, target, baseBranch, versionTag)
+	if err != nil {
+		return result, fmt.Errorf("could not sync locally: %w", err)
+	}
+
+	pushed := true
+	if pullRequest != nil {
+		if err := repo.CommitAndPush(featureBranch, changedPaths); errors.Is(err, ErrNoChanges) {
+			// The open pull request is up to date, so it is neither updated nor approved again.
+			pushed = false
+		} else if err != nil {
+			return result, fmt.Errorf("could not push to existing branch '%s': %w", featureBranch, err)
+		}
+	} else if err := repo.CreateAndPushToNewBranch(featureBranch, baseBranch, changedPaths); errors.Is(err, ErrNoChanges) {
+		// There were no changes, so we have nothing to make a pull request of.
+		return result, nil
+	} else if err != nil {
+		return result, fmt.Errorf("could not create and push to new branch '%s': %w", featureBranch, err)
+	}
+
+	if pushed {
+		workflowRun, err := GetCurrentWorkflowRun(syncer.GitHub, syncer.Config)
+		if err != nil {
+			return result, err
+		}
+
+		title := fmt.Sprintf("(sync): update workflows to %s", versionTag)
+		body := PullRequestBody(workflowRun, versionTag)
+		if pullRequest != nil {
+			pullRequest, err = UpdatePullRequest(syncer.GitHub, targetOwner, targetName, pullRequest, title, body)
+		} else {
+			pullRequest, err = CreatePullRequest(syncer.GitHub, targetOwner, targetName, featureBranch, baseBranch, title, body)
+		}
+		result.PullRequest = pullRequest
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if target.Merge.Mode == MergeModeNone {
+		return result, nil
+	}
+
+	if pushed && target.Merge.ShouldApprove() {
+		if err := ApprovePullRequest(syncer.Approver, targetOwner, targetName, pullRequest); err != nil {
+			return result, err
+		}
+	}
+
+	// With auto-merge and merge queues, GitHub waits for the required checks before merging.
+	switch target.Merge.Mode {
+	case MergeModeAuto:
+		// GitHub refuses auto-merge for pull requests that can already be merged, so those are
+		// merged directly below.
+		mergeableState, err := GetMergeableState(syncer.GitHub, targetOwner, targetName, pullRequest)
+		if err != nil {
+			return result, err
+		}
+		if mergeableState != MergeableStateClean {
+			if err := EnableAutoMerge(syncer.GitHub, targetOwner, targetName, pullRequest, target.Merge); err != nil {
+				return result, err
+			}
+			result.MergeScheduled = true
+			return result, nil
+		}
+	case MergeModeQueue:
+		if err := EnqueuePullRequest(syncer.GitHub, targetOwner, targetName, pullRequest); err != nil {
+			return result, err
+		}
+		result.MergeScheduled = true
+		return result, nil
+	}
+
+	if target.Checks.IsEnabled() {
+		headRef := pullRequest.GetHead().GetSHA()
+		if headRef == "" {
+			headRef = featureBranch
+		}
+
+		failingChecks, err := WaitForChecks(syncer.GitHub, targetOwner, targetName, headRef, target.Checks)
+		if err != nil {
+			return result, err
+		}
+		if len(failingChecks) > 0 {
+			result.FailingChecks = failingChecks
+			return result, fmt.Errorf("%v check(s) did not pass, so pull request #%v was left open", len(failingChecks), *pullRequest.Number)
+		}
+	}
+
+	if err := MergePullRequest(syncer.GitHub, targetOwner, targetName, pullRequest, target.Merge); err != nil {
+		return result, err
+	}
+	result.Merged = true
+
+	if err := repo.DeleteBranch(featureBranch, baseBranch); err != nil {
+		return result, fmt.Errorf("could not delete merged '%s' branch: %w", featureBranch, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,364 @@
+package common_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	common "github.com/workflow-sync-poc/common/code"
+	"github.com/workflow-sync-poc/common/code/githubfake"
+)
+
+const syncedWorkflowPath = ".github/workflows/synced_build.yaml"
+
+// syncEnvironment is a source repository with a "v1" tag, and a target "org/component" that is
+// backed by a local bare repository and the fake GitHub server.
+type syncEnvironment struct {
+	server    *githubfake.Server
+	syncer    *common.Syncer
+	sourceDir string
+	remoteDir string
+	target    common.SyncTarget
+}
+
+func runGit(t *testing.T, args ...string) string {
+	t.Helper()
+
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+
+	return string(out)
+}
+
+func commitToSource(t *testing.T, sourceDir string, workflow string, tag string) {
+	t.Helper()
+
+	if err := common.WriteFile(filepath.Join(sourceDir, syncedWorkflowPath), workflow); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, "-C", sourceDir, "add", ".")
+	runGit(t, "-C", sourceDir, "-c", "user.name=source", "-c", "user.email=source@example.com", "commit", "--quiet", "-m", "feat: release "+tag)
+	runGit(t, "-C", sourceDir, "tag", tag)
+}
+
+func newSyncEnvironment(t *testing.T, merge string) *syncEnvironment {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	sourceDir := t.TempDir()
+	runGit(t, "-C", sourceDir, "init", "--quiet", "--initial-branch=main")
+	if err := os.MkdirAll(filepath.Join(sourceDir, ".github", "workflows"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	commitToSource(t, sourceDir, "jobs:\n  build:\n    uses: 'org/common/.github/workflows/build.yaml@main'\n", "v1")
+	runGit(t, "-C", sourceDir, "tag", "v1.0.0")
+	releaseCommit := strings.TrimSpace(runGit(t, "-C", sourceDir, "rev-parse", "v1"))
+
+	remoteDir := filepath.Join(t.TempDir(), "component.git")
+	seedDir := t.TempDir()
+	runGit(t, "init", "--quiet", "--bare", "--initial-branch=main", remoteDir)
+	runGit(t, "-C", seedDir, "init", "--quiet", "--initial-branch=main")
+	if err := common.WriteFile(filepath.Join(seedDir, "README.md"), "# Component\n"); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, "-C", seedDir, "add", ".")
+	runGit(t, "-C", seedDir, "-c", "user.name=seed", "-c", "user.email=seed@example.com", "commit", "--quiet", "-m", "initial commit")
+	runGit(t, "-C", seedDir, "push", "--quiet", remoteDir, "main")
+
+	server := githubfake.NewServer()
+	t.Cleanup(server.Close)
+	server.AddRepository("org", "component", "main", remoteDir)
+	server.AddWorkflowRun("org/common", 42, "Tag & Sync", 7)
+
+	manifest, err := common.ParseManifest("version: 1\nrepositories:\n  - repository: 'org/component'\n    checks:\n      timeout: '1s'\n      interval: '10ms'\n    merge:\n      mode: '" + merge + "'\n")
+	if err != nil {
+		t.Fatalf("ParseManifest() returned an error: %v", err)
+	}
+
+	api := common.NewGitHubClient(server.Client())
+	config := &common.Config{
+		Host:             common.DefaultGitHubHost,
+		SourceRepository: "org/common",
+		WorkflowRunId:    42,
+		GitUser:          common.GitUser{Name: "sync-bot", Email: "sync-bot@example.com"},
+	}
+
+	return &syncEnvironment{
+		server: server,
+		syncer: &common.Syncer{
+			Config:        config,
+			GitHub:        api,
+			Approver:      api,
+			Git:           common.ExecGit{},
+			RemoteURL:     server.RemoteURL,
+			Workspace:     t.TempDir(),
+			Source:        "org/common",
+			SourceDir:     sourceDir,
+			SourceCommits: map[string]string{"v1": releaseCommit, "v1.0.0": releaseCommit},
+		},
+		sourceDir: sourceDir,
+		remoteDir: remoteDir,
+		target:    manifest.Targets()[0],
+	}
+}
+
+func (environment *syncEnvironment) remoteFile(t *testing.T, ref string, filePath string) string {
+	t.Helper()
+
+	return runGit(t, "--git-dir", environment.remoteDir, "show", ref+":"+filePath)
+}
+
+func (environment *syncEnvironment) remoteBranchExists(branch string) bool {
+	return exec.Command("git", "--git-dir", environment.remoteDir, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch).Run() == nil
+}
+
+func TestSyncRepositoryOpensPullRequest(t *testing.T) {
+	environment := newSyncEnvironment(t, common.MergeModeAuto)
+
+	result, err := environment.syncer.SyncRepository(environment.target, "v1")
+	if err != nil {
+		t.Fatalf("SyncRepository() returned an error: %v", err)
+	}
+
+	if result.PullRequest.GetNumber() != 1 || result.PullRequest.GetTitle() != "(sync): update workflows to v1" {
+		t.Errorf("SyncRepository() opened pull request #%v %q", result.PullRequest.GetNumber(), result.PullRequest.GetTitle())
+	}
+	if result.Merged || !result.MergeScheduled {
+		t.Errorf("SyncRepository() returned merged %v and merge scheduled %v, expected auto-merge", result.Merged, result.MergeScheduled)
+	}
+
+	pullRequest := environment.server.Repository("org/component").PullRequests[0]
+	if pullRequest.State != "open" || pullRequest.AutoMerge == nil || len(pullRequest.Reviews) != 1 {
+		t.Errorf("pull request is %s with auto-merge %+v and reviews %v", pullRequest.State, pullRequest.AutoMerge, pullRequest.Reviews)
+	}
+
+	workflow := environment.remoteFile(t, environment.target.Branch, syncedWorkflowPath)
+	if !strings.Contains(workflow, "uses: 'org/common/.github/workflows/build.yaml@v1'") {
+		t.Errorf("synced workflow does not use 'v1':\n%s", workflow)
+	}
+	lock, err := common.ParseSyncLock(environment.remoteFile(t, environment.target.Branch, common.LockPath))
+	if err != nil {
+		t.Fatalf("ParseSyncLock() returned an error: %v", err)
+	}
+	if lock.Tag != "v1.0.0" || lock.Commit != environment.syncer.SourceCommits["v1"] {
+		t.Errorf("lockfile records '%s' (%s), expected the release 'v1' points to", lock.Tag, lock.Commit)
+	}
+	if len(lock.Files) != 1 || lock.Files[0].Path != syncedWorkflowPath {
+		t.Errorf("lockfile does not list the synced workflow: %+v", lock.Files)
+	}
+}
+
+func TestSyncRepositoryUpdatesOpenPullRequest(t *testing.T) {
+	environment := newSyncEnvironment(t, common.MergeModeAuto)
+
+	if _, err := environment.syncer.SyncRepository(environment.target, "v1"); err != nil {
+		t.Fatalf("SyncRepository() returned an error: %v", err)
+	}
+
+	commitToSource(t, environment.sourceDir, "jobs:\n  test:\n    uses: 'org/common/.github/workflows/test.yaml@main'\n", "v2")
+
+	result, err := environment.syncer.SyncRepository(environment.target, "v2")
+	if err != nil {
+		t.Fatalf("SyncRepository() returned an error: %v", err)
+	}
+
+	pullRequests := environment.server.Repository("org/component").PullRequests
+	if len(pullRequests) != 1 || result.PullRequest.GetNumber() != 1 {
+		t.Fatalf("SyncRepository() returned pull request #%v, %v pull request(s) exist, expected #1 to be updated", result.PullRequest.GetNumber(), len(pullRequests))
+	}
+	if pullRequests[0].State != "open" || pullRequests[0].Title != "(sync): update workflows to v2" {
+		t.Errorf("pull request is %s with title %q", pullRequests[0].State, pullRequests[0].Title)
+	}
+
+	workflow := environment.remoteFile(t, environment.target.Branch, syncedWorkflowPath)
+	if !strings.Contains(workflow, "uses: 'org/common/.github/workflows/test.yaml@v2'") {
+		t.Errorf("synced workflow was not updated to 'v2':\n%s", workflow)
+	}
+
+	// The branch of the pull request is added to, so the commit of the first sync is kept.
+	if commits := runGit(t, "--git-dir", environment.remoteDir, "rev-list", "--count", "main.."+environment.target.Branch); strings.TrimSpace(commits) != "2" {
+		t.Errorf("branch has %s commit(s) on top of 'main', expected 2", strings.TrimSpace(commits))
+	}
+}
+
+func TestSyncRepositoryLeavesUnchangedPullRequestAlone(t *testing.T) {
+	environment := newSyncEnvironment(t, common.MergeModeAuto)
+
+	if _, err := environment.syncer.SyncRepository(environment.target, "v1"); err != nil {
+		t.Fatalf("SyncRepository() returned an error: %v", err)
+	}
+	pullRequest := environment.server.Repository("org/component").PullRequests[0]
+	pullRequest.Body = "Edited by a reviewer."
+
+	// A scheduled run without anything new to push.
+	result, err := environment.syncer.SyncRepository(environment.target, "v1")
+	if err != nil {
+		t.Fatalf("SyncRepository() returned an error: %v", err)
+	}
+
+	if result.PullRequest.GetNumber() != 1 || !result.MergeScheduled {
+		t.Errorf("SyncRepository() returned pull request #%v with merge scheduled %v", result.PullRequest.GetNumber(), result.MergeScheduled)
+	}
+	if len(pullRequest.Reviews) != 1 || pullRequest.Body != "Edited by a reviewer." {
+		t.Errorf("pull request has reviews %v and body %q, expected it to be left alone", pullRequest.Reviews, pullRequest.Body)
+	}
+	if commits := runGit(t, "--git-dir", environment.remoteDir, "rev-list", "--count", "main.."+environment.target.Branch); strings.TrimSpace(commits) != "1" {
+		t.Errorf("branch has %s commit(s) on top of 'main', expected 1", strings.TrimSpace(commits))
+	}
+}
+
+func TestSyncRepositoryMergesCleanPullRequestWithoutAutoMerge(t *testing.T) {
+	environment := newSyncEnvironment(t, common.MergeModeAuto)
+
+	if _, err := environment.syncer.SyncRepository(environment.target, "v1"); err != nil {
+		t.Fatalf("SyncRepository() returned an error: %v", err)
+	}
+
+	// GitHub refuses to enable auto-merge once the pull request can be merged.
+	environment.server.Repository("org/component").PullRequests[0].MergeableState = "clean"
+	environment.server.AddCheckRun("org/component", environment.target.Branch, "build", "completed", "success")
+	commitToSource(t, environment.sourceDir, "jobs:\n  test:\n    uses: 'org/common/.github/workflows/test.yaml@main'\n", "v2")
+
+	result, err := environment.syncer.SyncRepository(environment.target, "v2")
+	if err != nil {
+		t.Fatalf("SyncRepository() returned an error: %v", err)
+	}
+
+	pullRequest := environment.server.Repository("org/component").PullRequests[0]
+	if !result.Merged || result.MergeScheduled || !pullRequest.Merged {
+		t.Errorf("SyncRepository() returned merged %v and merge scheduled %v, expected a clean pull request to be merged directly", result.Merged, result.MergeScheduled)
+	}
+}
+
+func TestSyncRepositoryLeavesPullRequestOpenWhenChecksFail(t *testing.T) {
+	environment := newSyncEnvironment(t, common.MergeModeDirect)
+	environment.server.AddCheckRun("org/component", environment.target.Branch, "build", "completed", "failure")
+
+	result, err := environment.syncer.SyncRepository(environment.target, "v1")
+	if err == nil {
+		t.Fatalf("SyncRepository() did not return an error for a failing check")
+	}
+
+	if len(result.FailingChecks) != 1 || result.FailingChecks[0].Name != "build" {
+		t.Errorf("SyncRepository() returned failing checks %+v, expected 'build'", result.FailingChecks)
+	}
+
+	pullRequest := environment.server.Repository("org/component").PullRequests[0]
+	if result.Merged || pullRequest.Merged || pullRequest.State != "open" {
+		t.Errorf("pull request is %s and merged %v, expected it to be left open", pullRequest.State, pullRequest.Merged)
+	}
+	if !environment.remoteBranchExists(environment.target.Branch) {
+		t.Errorf("branch '%s' was deleted, although its pull request is open", environment.target.Branch)
+	}
+}
+
+func TestSyncRepositoryWaitsForChecksToBeReported(t *testing.T) {
+	environment := newSyncEnvironment(t, common.MergeModeDirect)
+
+	// CI has not reported any checks within the timeout, which is shorter than the grace period.
+	result, err := environment.syncer.SyncRepository(environment.target, "v1")
+	if err == nil {
+		t.Fatalf("SyncRepository() did not return an error without any reported checks")
+	}
+
+	pullRequest := environment.server.Repository("org/component").PullRequests[0]
+	if result.Merged || pullRequest.Merged || pullRequest.State != "open" {
+		t.Errorf("pull request is %s and merged %v, expected it to be left open", pullRequest.State, pullRequest.Merged)
+	}
+}
+
+func TestSyncRepositoryMergesAndDeletesBranch(t *testing.T) {
+	environment := newSyncEnvironment(t, common.MergeModeDirect)
+	environment.server.AddCheckRun("org/component", environment.target.Branch, "build", "completed", "success")
+
+	result, err := environment.syncer.SyncRepository(environment.target, "v1")
+	if err != nil {
+		t.Fatalf("SyncRepository() returned an error: %v", err)
+	}
+
+	pullRequest := environment.server.Repository("org/component").PullRequests[0]
+	if !result.Merged || !pullRequest.Merged || pullRequest.State != "closed" {
+		t.Errorf("pull request is %s and merged %v, expected it to be merged", pullRequest.State, pullRequest.Merged)
+	}
+
+	if workflow := environment.remoteFile(t, "main", syncedWorkflowPath); !strings.Contains(workflow, "@v1'") {
+		t.Errorf("synced workflow was not merged into 'main':\n%s", workflow)
+	}
+	if environment.remoteBranchExists(environment.target.Branch) {
+		t.Errorf("branch '%s' was not deleted after merging", environment.target.Branch)
+	}
+
+	// Everything is synced, so the next sync has nothing to open a pull request for.
+	result, err = environment.syncer.SyncRepository(environment.target, "v1")
+	if err != nil || result.PullRequest != nil {
+		t.Errorf("SyncRepository() of an up to date repository returned %+v (%v)", result.PullRequest, err)
+	}
+}
+
+// pushToTarget commits files directly to the default branch of the target, like a developer of
+// the target repository would.
+func (environment *syncEnvironment) pushToTarget(t *testing.T, files map[string]string) {
+	t.Helper()
+
+	cloneDir := t.TempDir()
+	runGit(t, "clone", "--quiet", environment.remoteDir, cloneDir)
+	for filePath, contents := range files {
+		if err := common.WriteFile(filepath.Join(cloneDir, filePath), contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, "-C", cloneDir, "add", ".")
+	runGit(t, "-C", cloneDir, "-c", "user.name=developer", "-c", "user.email=developer@example.com", "commit", "--quiet", "-m", "edit workflows")
+	runGit(t, "-C", cloneDir, "push", "--quiet", "origin", "main")
+}
+
+func TestDetectDriftAndFixWithoutMerging(t *testing.T) {
+	environment := newSyncEnvironment(t, common.MergeModeDirect)
+	environment.server.AddCheckRun("org/component", environment.target.Branch, "build", "completed", "success")
+	if _, err := environment.syncer.SyncRepository(environment.target, "v1"); err != nil {
+		t.Fatalf("SyncRepository() returned an error: %v", err)
+	}
+
+	environment.pushToTarget(t, map[string]string{
+		syncedWorkflowPath:                    "jobs: {}\n",
+		".github/workflows/synced_extra.yaml": "jobs: {}\n",
+		".github/workflows/own.yaml":          "jobs: {}\n",
+	})
+
+	drift, err := environment.syncer.DetectDrift(environment.target, "v1")
+	if err != nil {
+		t.Fatalf("DetectDrift() returned an error: %v", err)
+	}
+	expectedFiles := []common.FileDrift{
+		{Path: syncedWorkflowPath, Status: common.DriftModified, Ownership: common.OwnershipReplace},
+		{Path: ".github/workflows/synced_extra.yaml", Status: common.DriftExtra, Ownership: common.OwnershipReplace},
+	}
+	if !slices.Equal(drift.Files, expectedFiles) {
+		t.Errorf("DetectDrift() returned %+v, expected %+v", drift.Files, expectedFiles)
+	}
+
+	// Fixing drift opens a pull request that is neither approved nor merged.
+	target := environment.target
+	target.Merge = common.MergeConfig{Mode: common.MergeModeNone}
+	result, err := environment.syncer.SyncRepository(target, "v1")
+	if err != nil {
+		t.Fatalf("SyncRepository() returned an error: %v", err)
+	}
+
+	pullRequest := environment.server.Repository("org/component").PullRequests[1]
+	if result.Merged || result.MergeScheduled || pullRequest.Merged || pullRequest.State != "open" || len(pullRequest.Reviews) != 0 {
+		t.Errorf("pull request is %s, merged %v with reviews %v, expected it to be left open", pullRequest.State, pullRequest.Merged, pullRequest.Reviews)
+	}
+	if files := runGit(t, "--git-dir", environment.remoteDir, "ls-tree", "-r", "--name-only", target.Branch, ".github/workflows"); strings.Contains(files, "synced_extra.yaml") || !strings.Contains(files, "own.yaml") {
+		t.Errorf("pull request contains the workflows:\n%s", files)
+	}
+	if workflow := environment.remoteFile(t, target.Branch, syncedWorkflowPath); !strings.Contains(workflow, "@v1'") {
+		t.Errorf("pull request does not restore the synced workflow:\n%s", workflow)
+	}
+}
@@ -1,111 +1,175 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"regexp"
-	"strconv"
 	"strings"
 
 	common "github.com/workflow-sync-poc/common/code"
 )
 
-func nextMajorVersionForTag(tag string) int {
-	majorVersionPattern := regexp.MustCompile(`v(?P<MajorVersion>\d+)`)
-	majorVersionSubmatches := majorVersionPattern.FindStringSubmatch(tag)
-	majorVersionSubmatchIndex := majorVersionPattern.SubexpIndex("MajorVersion")
-	majorVersionString := majorVersionSubmatches[majorVersionSubmatchIndex]
-	majorVersion, err := strconv.Atoi(majorVersionString)
+func getBumpLevelSince(repo *common.Repo, manifest *common.Manifest, sinceTag string) (common.BumpLevel, string, []common.InterfaceChange, error) {
+	commitMessages, err := repo.GetCommitMessagesSince(sinceTag)
 	if err != nil {
-		panic(fmt.Errorf("could not parse major version from tag '%s': %v", tag, err))
+		return common.BumpNone, "", nil, err
 	}
 
-	return majorVersion + 1
-}
-
-func getSyncedReposDefinitionChangedSince(sinceTag string) []string {
-	syncedReposDefinitionChanged, err := common.GetFilesChangedSince(sinceTag, "repos.json")
+	changes, err := repo.GetChangesSince(sinceTag)
 	if err != nil {
-		panic(err)
+		return common.BumpNone, "", nil, err
 	}
 
-	return syncedReposDefinitionChanged
-}
-
-func getSyncedWorkflowsChangedSince(sinceTag string) []string {
-	syncedWorkflowsChanged, err := common.GetFilesChangedSince(sinceTag, ".github/workflows/synced_*")
+	interfaceChanges, err := repo.GetWorkflowInterfaceChangesSince(sinceTag)
 	if err != nil {
-		panic(err)
+		return common.BumpNone, "", nil, err
+	}
+
+	commitsLevel := common.BumpLevelFromCommits(commitMessages)
+	changesLevel := common.BumpLevelFromChanges(changes, manifest.IsSynced)
+	interfaceLevel := common.BumpLevelFromInterfaceChanges(interfaceChanges)
+	if interfaceLevel >= commitsLevel && interfaceLevel >= changesLevel && interfaceLevel != common.BumpNone {
+		return interfaceLevel, fmt.Sprintf("of the %v workflow interface change(s) since `%s`", len(interfaceChanges), sinceTag), interfaceChanges, nil
+	} else if commitsLevel >= changesLevel {
+		return commitsLevel, fmt.Sprintf("of the %v commit message(s) since `%s`", len(commitMessages), sinceTag), interfaceChanges, nil
 	}
 
-	return syncedWorkflowsChanged
+	return changesLevel, fmt.Sprintf("of the %v file(s) that changed since `%s`", len(changes), sinceTag), interfaceChanges, nil
 }
 
-func shouldIncrementTag(lastTag string) bool {
-	return reasonToSyncWorkflowsSince(lastTag) != ""
+func getInterfaceChangesList(interfaceChanges []common.InterfaceChange) []string {
+	var lines []string
+	for _, change := range interfaceChanges {
+		icon := "➕"
+		if change.IsBreaking() {
+			icon = "⚠️"
+		} else if change.Level == common.BumpPatch {
+			icon = "🔧"
+		}
+
+		lines = append(lines, fmt.Sprintf("- %s `%s`: %s (%s)", icon, change.Workflow, change.Description, change.Level))
+	}
+
+	return lines
 }
 
-func reasonToSyncWorkflowsSince(sinceTag string) string {
-	hasEverSynced, err := common.TagExists(sinceTag)
-	if err != nil {
-		panic(err)
+func releaseVersion(repo *common.Repo, version common.Version) error {
+	if err := repo.AddTag(version.String()); err != nil {
+		return err
 	}
 
-	if !hasEverSynced {
-		return fmt.Sprintf("no `%s` tag exists yet", sinceTag)
+	for _, floatingTag := range []string{version.MinorTag(), version.MajorTag()} {
+		if err := repo.AddOrMoveTag(floatingTag); err != nil {
+			return err
+		}
 	}
 
-	changedFiles := append(getSyncedWorkflowsChangedSince(sinceTag), getSyncedReposDefinitionChangedSince(sinceTag)...)
-	if len(changedFiles) == 0 {
-		return ""
+	return nil
+}
+
+// getReasonsToSync lists why every enabled target that is behind has to be synced.
+func getReasonsToSync(repo *common.Repo, manifest *common.Manifest, versionTag string) ([]string, error) {
+	tagCommits, err := repo.GetTagCommits()
+	if err != nil {
+		return nil, err
 	}
 
-	wereOrWas := "were"
-	if len(changedFiles) == 1 {
-		wereOrWas = "was"
+	var reasonsToSync []string
+	for _, target := range manifest.EnabledTargets() {
+		reasonToSync, err := repo.GetReasonToSync(target, versionTag, tagCommits)
+		if err != nil {
+			return nil, err
+		}
+
+		if reasonToSync != "" {
+			reasonsToSync = append(reasonsToSync, fmt.Sprintf("- `%s`, because %s.", target.Repository, reasonToSync))
+		}
 	}
 
-	return fmt.Sprintf("`%s` %s different since `%s`", strings.Join(changedFiles, "`, `"), wereOrWas, sinceTag)
+	return reasonsToSync, nil
 }
 
-func main() {
-	common.SetupGitHubUser()
-	sourceRepo, err := common.GetCurrentRepository()
+func tag(config *common.Config) error {
+	manifest, err := common.LoadManifest(common.ManifestPath)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	repo := common.OpenRepo(config, ".")
+	if err := repo.SetupGitHubUser(config.GitUser); err != nil {
+		return err
 	}
 
-	tag, err := common.GetLatestVersionTag(sourceRepo)
+	sourceRepo := config.SourceRepository
+	if sourceRepo == "" {
+		if sourceRepo, err = repo.GetCurrentRepository(); err != nil {
+			return err
+		}
+	}
+
+	latestVersion, latestTag, err := repo.GetLatestVersion(sourceRepo)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	var summaryLines []string
 
-	if tag == "" {
-		tag = "v1"
-		if err := common.AddTag(tag); err != nil {
-			panic(err)
+	if latestTag == "" {
+		version := common.Version{Major: 1}
+		if err := releaseVersion(repo, version); err != nil {
+			return err
 		}
-		summaryLines = append(summaryLines, fmt.Sprintf("### 🏷️ Tag `%s` Created", tag))
-	} else if shouldIncrementTag(tag) {
-		nextMajorVersion := nextMajorVersionForTag(tag)
-		nextTag := fmt.Sprintf("v%v", nextMajorVersion)
-		if err := common.AddTag(nextTag); err != nil {
-			panic(err)
+		latestVersion = version
+		summaryLines = append(summaryLines, fmt.Sprintf("### 🏷️ Release `%s` Created", version))
+	} else if level, reason, interfaceChanges, err := getBumpLevelSince(repo, manifest, latestTag); err != nil {
+		return err
+	} else if level != common.BumpNone {
+		version := latestVersion.Bump(level)
+		if err := releaseVersion(repo, version); err != nil {
+			return err
 		}
-		summaryLines = append(summaryLines, fmt.Sprintf("### 🏷️ Tag `%s` Created", nextTag))
-	} else {
-		if err := common.MoveTag(tag); err != nil {
-			panic(err)
+		latestVersion = version
+		summaryLines = append(summaryLines, fmt.Sprintf("### 🏷️ Release `%s` Created", version))
+		summaryLines = append(summaryLines, fmt.Sprintf("*This is a %s release, because %s.*", level, reason))
+		if len(interfaceChanges) > 0 {
+			summaryLines = append(summaryLines, "#### Workflow Interface Changes")
+			summaryLines = append(summaryLines, getInterfaceChangesList(interfaceChanges)...)
 		}
-		summaryLines = append(summaryLines, fmt.Sprintf("### 🏷️ Tag `%s` Updated", tag))
+	} else {
+		summaryLines = append(summaryLines, fmt.Sprintf("### 🏷️ Release `%s` Unchanged", latestTag))
+	}
+
+	reasonsToSync, err := getReasonsToSync(repo, manifest, latestVersion.MajorTag())
+	if err != nil {
+		return err
+	}
+	if len(reasonsToSync) > 0 {
+		summaryLines = append(summaryLines, fmt.Sprintf("*Workflows need to be synchronized to %v repo(s):*", len(reasonsToSync)))
+		summaryLines = append(summaryLines, reasonsToSync...)
+	}
+
+	if retrySummary := common.Retries.Summary(); retrySummary != "" {
+		summaryLines = append(summaryLines, retrySummary)
+	}
+
+	if err := common.WriteOutput(config, fmt.Sprintf("%v", len(reasonsToSync) > 0)); err != nil {
+		return err
+	}
+
+	return common.WriteJobSummary(config, strings.Join(summaryLines, "\r\n"))
+}
+
+func main() {
+	if err := common.SetupRedaction(); err != nil {
+		common.Exit(nil, "tag", err)
 	}
 
-	reasonToSync := reasonToSyncWorkflowsSince("last-synced")
-	if reasonToSync != "" {
-		summaryLines = append(summaryLines, fmt.Sprintf("*Workflows need to be synchronized, because %s.*", reasonToSync))
+	configFlags := common.RegisterConfigFlags(flag.CommandLine)
+	flag.Parse()
+
+	config, err := configFlags.Load(common.NeedsAuth)
+	if err != nil {
+		common.Exit(nil, "tag", err)
 	}
 
-	common.WriteOutput(fmt.Sprintf("%v", reasonToSync != ""))
-	common.WriteJobSummary(strings.Join(summaryLines, "\r\n"))
+	common.Exit(config, "tag", tag(config))
 }
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// Synced files are rendered with "{%" and "%}" as delimiters, since "${{ }}" already means
+// something in workflows, e.g. "{% .Name %}" or "{% var "go-version" %}". Unlike `index`, `var`
+// fails for variables that are not set. Like any YAML value starting with "{", values starting
+// with a template expression have to be quoted.
+const (
+	TemplateLeftDelimiter  = "{%"
+	TemplateRightDelimiter = "%}"
+)
+
+type TemplateData struct {
+	Repository    string
+	Owner         string
+	Name          string
+	DefaultBranch string
+	Version       string
+	Vars          map[string]string
+}
+
+func NewTemplateData(target SyncTarget, baseBranch string, versionTag string) (TemplateData, error) {
+	owner, name, err := RepoOwnerName(target.Repository)
+	if err != nil {
+		return TemplateData{}, err
+	}
+
+	vars := target.Variables
+	if vars == nil {
+		vars = map[string]string{}
+	}
+
+	return TemplateData{
+		Repository:    target.Repository,
+		Owner:         owner,
+		Name:          name,
+		DefaultBranch: baseBranch,
+		Version:       versionTag,
+		Vars:          vars,
+	}, nil
+}
+
+func RenderTemplate(name string, contents string, data TemplateData) (string, error) {
+	functions := template.FuncMap{
+		"var": func(key string) (string, error) {
+			value, ok := data.Vars[key]
+			if !ok {
+				return "", fmt.Errorf("variable '%s' is not set for '%s'", key, data.Repository)
+			}
+
+			return value, nil
+		},
+	}
+
+	parsedTemplate, err := template.New(name).
+		Delims(TemplateLeftDelimiter, TemplateRightDelimiter).
+		Funcs(functions).
+		Option("missingkey=error").
+		Parse(contents)
+	if err != nil {
+		return "", fmt.Errorf("could not parse template: %w", err)
+	}
+
+	var rendered bytes.Buffer
+	if err := parsedTemplate.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("could not render template: %w", err)
+	}
+
+	return rendered.String(), nil
+}
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	data, err := NewTemplateData(SyncTarget{Repository: "org/component", Variables: map[string]string{"go-version": "1.22"}}, "main", "v1")
+	if err != nil {
+		t.Fatalf("NewTemplateData() returned an error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		contents string
+		expected string
+	}{
+		{"fields", "name: '{% .Name %} of {% .Owner %} on {% .DefaultBranch %} at {% .Version %}'\n", "name: 'component of org on main at v1'\n"},
+		{"variable", "go-version: '{% var \"go-version\" %}'\n", "go-version: '1.22'\n"},
+		{"workflow expressions", "if: ${{ github.ref == 'refs/heads/{% .DefaultBranch %}' }}\n", "if: ${{ github.ref == 'refs/heads/main' }}\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rendered, err := RenderTemplate("workflow.yaml", test.contents, data)
+			if err != nil {
+				t.Fatalf("RenderTemplate() returned an error: %v", err)
+			}
+
+			if rendered != test.expected {
+				t.Errorf("RenderTemplate() returned %q, expected %q", rendered, test.expected)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateReportsErrors(t *testing.T) {
+	data, err := NewTemplateData(SyncTarget{Repository: "org/component"}, "main", "v1")
+	if err != nil {
+		t.Fatalf("NewTemplateData() returned an error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		contents string
+		problem  string
+	}{
+		{"missing variable", "go-version: '{% var \"go-version\" %}'\n", "variable 'go-version' is not set for 'org/component'"},
+		{"unknown field", "name: '{% .Unknown %}'\n", "can't evaluate field Unknown"},
+		{"unclosed action", "name: '{% .Name '\n", "could not parse template"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := RenderTemplate("workflow.yaml", test.contents, data)
+			if err == nil || !strings.Contains(err.Error(), test.problem) {
+				t.Errorf("RenderTemplate() returned %v, expected an error containing %q", err, test.problem)
+			}
+		})
+	}
+}
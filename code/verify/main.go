@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	common "github.com/workflow-sync-poc/common/code"
+)
+
+func verify(config *common.Config, dir string, summary bool) error {
+	lockPath := filepath.Join(dir, common.LockPath)
+	lock, err := common.LoadSyncLock(lockPath)
+	if err != nil {
+		return err
+	}
+
+	violations := common.VerifySyncLock(dir, lock)
+
+	var summaryLines []string
+	if len(violations) == 0 {
+		summaryLines = append(summaryLines, fmt.Sprintf("### ✔️ Synced Files Match `%s` from `%s`", lock.Tag, lock.Source))
+		summaryLines = append(summaryLines, fmt.Sprintf("*All `%v` managed files are as they were synced.*", len(lock.Files)))
+	} else {
+		summaryLines = append(summaryLines, fmt.Sprintf("### ❌ `%v/%v` Synced Files Were Edited", len(violations), len(lock.Files)))
+		for _, violation := range violations {
+			log.Printf("'%s' %s\n", violation.Path, violation.Problem)
+			summaryLines = append(summaryLines, fmt.Sprintf("- `%s` %s", violation.Path, violation.Problem))
+		}
+		summaryLines = append(summaryLines, fmt.Sprintf("*These files are managed by `%s`, so edits should be made there, they are overwritten by the next sync.*", lock.Source))
+	}
+
+	if summary {
+		if err := common.WriteJobSummary(config, strings.Join(summaryLines, "\r\n")); err != nil {
+			return err
+		}
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("%v/%v files differ from '%s': %w", len(violations), len(lock.Files), lock.Tag, common.ErrSyncedFilesEdited)
+	}
+
+	return nil
+}
+
+func main() {
+	if err := common.SetupRedaction(); err != nil {
+		common.Exit(nil, "verify", err)
+	}
+
+	dir := flag.String("dir", ".", "the checkout of the target repository to verify")
+	summary := flag.Bool("summary", true, "write the result to the job summary")
+	configFlags := common.RegisterConfigFlags(flag.CommandLine)
+	flag.Parse()
+
+	config, err := configFlags.Load()
+	if err != nil {
+		common.Exit(nil, "verify", err)
+	}
+
+	common.Exit(config, "verify", verify(config, *dir, *summary))
+}
@@ -0,0 +1,213 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var versionPattern = regexp.MustCompile(`^v(\d+)(?:\.(\d+))?(?:\.(\d+))?$`)
+
+var (
+	commitTypePattern     = regexp.MustCompile(`^(\w+)(?:\([^)]*\))?(!)?:`)
+	breakingFooterPattern = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE:`)
+)
+
+// releaseCommitTypes are the commit types that release a new version, commits of other types
+// (e.g. "docs", "chore" or "ci") only release one when they change synced files or RuntimeFiles.
+var releaseCommitTypes = map[string]BumpLevel{
+	"feat": BumpMinor,
+	"fix":  BumpPatch,
+	"perf": BumpPatch,
+}
+
+// RuntimeFiles are run by consumers at the release tag, because synced workflows call
+// run-go-file.yaml with "go-file-ref" pointed at it.
+var RuntimeFiles = []FileSet{
+	{Source: "code/**/*.go"},
+	{Source: "go.{mod,sum}"},
+	{Source: ".github/workflows/run-go-file.yaml"},
+}
+
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+type BumpLevel int
+
+const (
+	BumpNone BumpLevel = iota
+	BumpPatch
+	BumpMinor
+	BumpMajor
+)
+
+func (level BumpLevel) String() string {
+	switch level {
+	case BumpPatch:
+		return "patch"
+	case BumpMinor:
+		return "minor"
+	case BumpMajor:
+		return "major"
+	}
+
+	return "none"
+}
+
+// ParseVersion parses "vMAJOR.MINOR.PATCH" tags, and returns how many of the parts were present,
+// so that floating tags like "v1" and "v1.2" can be told apart from releases.
+func ParseVersion(tag string) (Version, int, bool) {
+	versionSubmatches := versionPattern.FindStringSubmatch(tag)
+	if versionSubmatches == nil {
+		return Version{}, 0, false
+	}
+
+	var parts []int
+	for _, part := range versionSubmatches[1:] {
+		if part == "" {
+			break
+		}
+
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return Version{}, 0, false
+		}
+		parts = append(parts, number)
+	}
+
+	partCount := len(parts)
+	for len(parts) < 3 {
+		parts = append(parts, 0)
+	}
+
+	return Version{Major: parts[0], Minor: parts[1], Patch: parts[2]}, partCount, true
+}
+
+func (version Version) String() string {
+	return fmt.Sprintf("v%v.%v.%v", version.Major, version.Minor, version.Patch)
+}
+
+func (version Version) MajorTag() string {
+	return fmt.Sprintf("v%v", version.Major)
+}
+
+func (version Version) MinorTag() string {
+	return fmt.Sprintf("v%v.%v", version.Major, version.Minor)
+}
+
+func (version Version) Compare(other Version) int {
+	if version.Major != other.Major {
+		return version.Major - other.Major
+	}
+	if version.Minor != other.Minor {
+		return version.Minor - other.Minor
+	}
+
+	return version.Patch - other.Patch
+}
+
+func (version Version) Bump(level BumpLevel) Version {
+	switch level {
+	case BumpMajor:
+		return Version{Major: version.Major + 1}
+	case BumpMinor:
+		return Version{Major: version.Major, Minor: version.Minor + 1}
+	case BumpPatch:
+		return Version{Major: version.Major, Minor: version.Minor, Patch: version.Patch + 1}
+	}
+
+	return version
+}
+
+// BumpLevelFromCommits follows https://www.conventionalcommits.org, e.g. "feat!: ..." or a
+// "BREAKING CHANGE:" footer is a major bump, "feat: ..." is a minor bump and "fix: ..." a patch.
+// Other commit types and messages that are not conventional do not bump the version.
+func BumpLevelFromCommits(messages []string) BumpLevel {
+	level := BumpNone
+	for _, message := range messages {
+		message = strings.TrimSpace(message)
+
+		commitType := commitTypePattern.FindStringSubmatch(message)
+		if (commitType != nil && commitType[2] == "!") || breakingFooterPattern.MatchString(message) {
+			return BumpMajor
+		} else if commitType != nil {
+			level = max(level, releaseCommitTypes[commitType[1]])
+		}
+	}
+
+	return level
+}
+
+// BumpLevelFromChanges classifies what changed for consumers: removing a synced file takes it
+// away from them, adding one gives them something new and anything else is a patch. Changes to
+// the RuntimeFiles are patches too, other files do not reach consumers.
+func BumpLevelFromChanges(changes []FileChange, isSynced func(string) bool) BumpLevel {
+	level := BumpNone
+	for _, change := range changes {
+		if !isSynced(change.Path) {
+			if isRuntimeFile(change.Path) {
+				level = max(level, BumpPatch)
+			}
+			continue
+		}
+
+		switch change.Status {
+		case "removed":
+			return BumpMajor
+		case "added":
+			level = max(level, BumpMinor)
+		default:
+			level = max(level, BumpPatch)
+		}
+	}
+
+	return level
+}
+
+func isRuntimeFile(filePath string) bool {
+	if strings.HasSuffix(filePath, "_test.go") {
+		return false
+	}
+
+	return slices.ContainsFunc(RuntimeFiles, func(fileSet FileSet) bool {
+		return fileSet.MatchesSource(filePath)
+	})
+}
+
+func (repo *Repo) GetLatestVersion(remoteRepo string) (Version, string, error) {
+	if err := repo.SetOrigin(remoteRepo); err != nil {
+		return Version{}, "", err
+	}
+
+	tags, err := repo.RemoteTags()
+	if err != nil {
+		return Version{}, "", fmt.Errorf("could not get latest version: %w", err)
+	}
+
+	// Floating "vN" and "vN.M" tags point at the latest release, and only count if there are no
+	// full releases yet (i.e. repositories that were tagged before semantic versioning).
+	latestTag := ""
+	latestVersion := Version{}
+	latestParts := 0
+	for _, tag := range tags {
+		version, parts, ok := ParseVersion(tag.ShortName())
+		if !ok {
+			continue
+		}
+
+		if latestTag != "" && (parts < latestParts || (parts == latestParts && version.Compare(latestVersion) <= 0)) {
+			continue
+		}
+
+		latestTag = tag.ShortName()
+		latestVersion = version
+		latestParts = parts
+	}
+
+	return latestVersion, latestTag, nil
+}
@@ -0,0 +1,171 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		tag     string
+		version Version
+		parts   int
+		ok      bool
+	}{
+		{"v1.2.3", Version{Major: 1, Minor: 2, Patch: 3}, 3, true},
+		{"v10.0.12", Version{Major: 10, Patch: 12}, 3, true},
+		{"v1.2", Version{Major: 1, Minor: 2}, 2, true},
+		{"v1", Version{Major: 1}, 1, true},
+		{"1.2.3", Version{}, 0, false},
+		{"v1.2.3-rc.1", Version{}, 0, false},
+		{"v1..3", Version{}, 0, false},
+		{"last-synced/org/a", Version{}, 0, false},
+		{"", Version{}, 0, false},
+	}
+
+	for _, test := range tests {
+		version, parts, ok := ParseVersion(test.tag)
+		if version != test.version || parts != test.parts || ok != test.ok {
+			t.Errorf("ParseVersion(%q) = %+v, %v, %v, expected %+v, %v, %v", test.tag, version, parts, ok, test.version, test.parts, test.ok)
+		}
+	}
+}
+
+func TestVersionTags(t *testing.T) {
+	version := Version{Major: 2, Minor: 5, Patch: 1}
+	if version.String() != "v2.5.1" || version.MinorTag() != "v2.5" || version.MajorTag() != "v2" {
+		t.Errorf("version has tags %q, %q and %q", version.String(), version.MinorTag(), version.MajorTag())
+	}
+}
+
+func TestVersionBump(t *testing.T) {
+	version := Version{Major: 1, Minor: 2, Patch: 3}
+	tests := []struct {
+		level    BumpLevel
+		expected Version
+	}{
+		{BumpNone, Version{Major: 1, Minor: 2, Patch: 3}},
+		{BumpPatch, Version{Major: 1, Minor: 2, Patch: 4}},
+		{BumpMinor, Version{Major: 1, Minor: 3}},
+		{BumpMajor, Version{Major: 2}},
+	}
+
+	for _, test := range tests {
+		if bumped := version.Bump(test.level); bumped != test.expected {
+			t.Errorf("Bump(%s) = %s, expected %s", test.level, bumped, test.expected)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		version Version
+		other   Version
+		sign    int
+	}{
+		{Version{Major: 1}, Version{Major: 1}, 0},
+		{Version{Major: 2}, Version{Major: 1, Minor: 9, Patch: 9}, 1},
+		{Version{Major: 1, Minor: 2}, Version{Major: 1, Minor: 10}, -1},
+		{Version{Major: 1, Patch: 2}, Version{Major: 1, Patch: 1}, 1},
+	}
+
+	for _, test := range tests {
+		comparison := test.version.Compare(test.other)
+		if (comparison > 0) != (test.sign > 0) || (comparison < 0) != (test.sign < 0) {
+			t.Errorf("%s.Compare(%s) = %v, expected the sign of %v", test.version, test.other, comparison, test.sign)
+		}
+	}
+}
+
+func TestBumpLevelFromCommits(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		expected BumpLevel
+	}{
+		{"no commits", nil, BumpNone},
+		{"fix", []string{"fix: handle empty inputs"}, BumpPatch},
+		{"perf with scope", []string{"perf(build): cache modules"}, BumpPatch},
+		{"feature", []string{"fix: typo", "feat: add lint workflow"}, BumpMinor},
+		{"feature with scope", []string{"feat(release): add changelog"}, BumpMinor},
+		{"breaking type", []string{"feat!: require go-version"}, BumpMajor},
+		{"breaking type with scope", []string{"refactor(inputs)!: rename inputs"}, BumpMajor},
+		{"breaking footer", []string{"fix: inputs\n\nBREAKING CHANGE: 'go-file' was removed"}, BumpMajor},
+		{"breaking footer with hyphen", []string{"chore: inputs\n\nBREAKING-CHANGE: removed"}, BumpMajor},
+		{"non-release types", []string{"docs: explain tags", "chore: update tools", "ci: run on pushes", "test: cover refs", "style: format", "refactor: rename", "build: bump go"}, BumpNone},
+		{"not conventional", []string{"Update README", "Merge pull request #12 from org/branch"}, BumpNone},
+		{"breaking text in the body only", []string{"docs: mention that a BREAKING CHANGE: needs a footer"}, BumpNone},
+		{"leading whitespace", []string{"\n  feat: add workflow\n"}, BumpMinor},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if level := BumpLevelFromCommits(test.messages); level != test.expected {
+				t.Errorf("BumpLevelFromCommits(%q) = %s, expected %s", test.messages, level, test.expected)
+			}
+		})
+	}
+}
+
+func TestBumpLevelFromChanges(t *testing.T) {
+	isSynced := func(filePath string) bool {
+		return DefaultFileSets[0].MatchesSource(filePath)
+	}
+
+	tests := []struct {
+		name     string
+		changes  []FileChange
+		expected BumpLevel
+	}{
+		{"no changes", nil, BumpNone},
+		{"files that are not synced", []FileChange{{Path: "README.md", Status: "modified"}, {Path: "code/sync_test.go", Status: "removed"}, {Path: ".github/workflows/tag.yaml", Status: "added"}}, BumpNone},
+		{"code that consumers run", []FileChange{{Path: "code/sync.go", Status: "modified"}}, BumpPatch},
+		{"removed command", []FileChange{{Path: "code/tag/main.go", Status: "removed"}}, BumpPatch},
+		{"dependencies", []FileChange{{Path: "go.sum", Status: "modified"}}, BumpPatch},
+		{"reusable workflow that runs the code", []FileChange{{Path: ".github/workflows/run-go-file.yaml", Status: "modified"}}, BumpPatch},
+		{"added synced file and modified code", []FileChange{{Path: "code/sync.go", Status: "modified"}, {Path: ".github/workflows/synced_lint.yml", Status: "added"}}, BumpMinor},
+		{"modified synced file", []FileChange{{Path: ".github/workflows/synced_build.yaml", Status: "modified"}}, BumpPatch},
+		{"added synced file", []FileChange{{Path: ".github/workflows/synced_build.yaml", Status: "modified"}, {Path: ".github/workflows/synced_lint.yml", Status: "added"}}, BumpMinor},
+		{"removed synced file", []FileChange{{Path: ".github/workflows/synced_lint.yml", Status: "added"}, {Path: ".github/workflows/synced_build.yaml", Status: "removed"}}, BumpMajor},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if level := BumpLevelFromChanges(test.changes, isSynced); level != test.expected {
+				t.Errorf("BumpLevelFromChanges(%+v) = %s, expected %s", test.changes, level, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetLatestVersion(t *testing.T) {
+	tests := []struct {
+		name            string
+		tags            []string
+		expectedTag     string
+		expectedVersion Version
+	}{
+		{"no tags", nil, "", Version{}},
+		{"releases", []string{"v1", "v1.1", "v1.1.0", "v1.0.9", "v1.10.0", "last-synced/org/a"}, "v1.10.0", Version{Major: 1, Minor: 10}},
+		{"only floating tags", []string{"v1", "v2", "v1.4"}, "v1.4", Version{Major: 1, Minor: 4}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := NewMemoryGit()
+			remote := backend.AddRemote("memory://org/common", "main", map[string]string{"README.md": "# Common\n"})
+			for _, tag := range test.tags {
+				remote.Tags[tag] = remote.Branches["main"]
+			}
+
+			repo := &Repo{Dir: t.TempDir(), Backend: backend, RemoteURL: func(repo string) string { return "memory://" + repo }}
+			if err := repo.Clone("org/common", "main"); err != nil {
+				t.Fatalf("Clone() returned an error: %v", err)
+			}
+
+			version, tag, err := repo.GetLatestVersion("org/common")
+			if err != nil || tag != test.expectedTag || version != test.expectedVersion {
+				t.Errorf("GetLatestVersion() = %s, %q, %v, expected %s, %q", version, tag, err, test.expectedVersion, test.expectedTag)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package common
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const WorkflowsDirectory = ".github/workflows"
+
+// WorkflowInterface is what callers of a reusable workflow depend on, i.e. its "on.workflow_call".
+type WorkflowInterface struct {
+	Inputs  map[string]WorkflowInput  `yaml:"inputs"`
+	Outputs map[string]WorkflowOutput `yaml:"outputs"`
+	Secrets map[string]WorkflowSecret `yaml:"secrets"`
+}
+
+type WorkflowInput struct {
+	Type        string `yaml:"type"`
+	Required    bool   `yaml:"required"`
+	Default     any    `yaml:"default"`
+	Description string `yaml:"description"`
+}
+
+type WorkflowOutput struct {
+	Value       string `yaml:"value"`
+	Description string `yaml:"description"`
+}
+
+type WorkflowSecret struct {
+	Required    bool   `yaml:"required"`
+	Description string `yaml:"description"`
+}
+
+type InterfaceChange struct {
+	Workflow    string
+	Description string
+	Level       BumpLevel
+}
+
+func (change InterfaceChange) IsBreaking() bool {
+	return change.Level == BumpMajor
+}
+
+// ParseWorkflowInterface returns nil if the workflow cannot be called by other workflows.
+func ParseWorkflowInterface(contents string) (*WorkflowInterface, error) {
+	var workflow struct {
+		On yaml.Node `yaml:"on"`
+	}
+	if err := yaml.Unmarshal([]byte(contents), &workflow); err != nil {
+		return nil, fmt.Errorf("could not parse workflow: %w", err)
+	}
+
+	switch workflow.On.Kind {
+	case yaml.ScalarNode:
+		if workflow.On.Value == "workflow_call" {
+			return &WorkflowInterface{}, nil
+		}
+	case yaml.SequenceNode:
+		for _, event := range workflow.On.Content {
+			if event.Value == "workflow_call" {
+				return &WorkflowInterface{}, nil
+			}
+		}
+	case yaml.MappingNode:
+		for index := 0; index+1 < len(workflow.On.Content); index += 2 {
+			if workflow.On.Content[index].Value != "workflow_call" {
+				continue
+			}
+
+			workflowInterface := &WorkflowInterface{}
+			if err := workflow.On.Content[index+1].Decode(workflowInterface); err != nil {
+				return nil, fmt.Errorf("could not parse 'on.workflow_call': %w", err)
+			}
+
+			return workflowInterface, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// CompareWorkflowInterfaces lists what changed for callers: anything that can make an existing
+// call fail is breaking, anything callers may start using is additive and the rest is a patch.
+func CompareWorkflowInterfaces(workflow string, previous *WorkflowInterface, current *WorkflowInterface) []InterfaceChange {
+	changes := []InterfaceChange{}
+	addChange := func(level BumpLevel, format string, args ...any) {
+		changes = append(changes, InterfaceChange{Workflow: workflow, Description: fmt.Sprintf(format, args...), Level: level})
+	}
+
+	if previous == nil && current == nil {
+		return changes
+	} else if previous == nil {
+		addChange(BumpMinor, "workflow can now be called")
+		return changes
+	} else if current == nil {
+		addChange(BumpMajor, "workflow can no longer be called")
+		return changes
+	}
+
+	for _, name := range sortedKeys(previous.Inputs) {
+		previousInput := previous.Inputs[name]
+		currentInput, ok := current.Inputs[name]
+		if !ok {
+			addChange(BumpMajor, "input `%s` was removed", name)
+		} else if currentInput.Required && !previousInput.Required {
+			addChange(BumpMajor, "input `%s` is now required", name)
+		} else if currentInput.Type != previousInput.Type {
+			addChange(BumpMajor, "input `%s` changed type from `%s` to `%s`", name, previousInput.Type, currentInput.Type)
+		} else if !currentInput.Required && previousInput.Required {
+			addChange(BumpPatch, "input `%s` is now optional", name)
+		} else if fmt.Sprint(currentInput.Default) != fmt.Sprint(previousInput.Default) {
+			addChange(BumpPatch, "input `%s` changed its default to `%v`", name, currentInput.Default)
+		}
+	}
+	for _, name := range sortedKeys(current.Inputs) {
+		if _, ok := previous.Inputs[name]; ok {
+			continue
+		}
+
+		if current.Inputs[name].Required {
+			addChange(BumpMajor, "required input `%s` was added", name)
+		} else {
+			addChange(BumpMinor, "optional input `%s` was added", name)
+		}
+	}
+
+	for _, name := range sortedKeys(previous.Outputs) {
+		if _, ok := current.Outputs[name]; !ok {
+			addChange(BumpMajor, "output `%s` was removed", name)
+		}
+	}
+	for _, name := range sortedKeys(current.Outputs) {
+		if _, ok := previous.Outputs[name]; !ok {
+			addChange(BumpMinor, "output `%s` was added", name)
+		}
+	}
+
+	for _, name := range sortedKeys(previous.Secrets) {
+		currentSecret, ok := current.Secrets[name]
+		if !ok {
+			addChange(BumpMajor, "secret `%s` was removed", name)
+		} else if currentSecret.Required && !previous.Secrets[name].Required {
+			addChange(BumpMajor, "secret `%s` is now required", name)
+		}
+	}
+	for _, name := range sortedKeys(current.Secrets) {
+		if _, ok := previous.Secrets[name]; ok {
+			continue
+		}
+
+		if current.Secrets[name].Required {
+			addChange(BumpMajor, "required secret `%s` was added", name)
+		} else {
+			addChange(BumpMinor, "optional secret `%s` was added", name)
+		}
+	}
+
+	return changes
+}
+
+func BumpLevelFromInterfaceChanges(changes []InterfaceChange) BumpLevel {
+	level := BumpNone
+	for _, change := range changes {
+		level = max(level, change.Level)
+	}
+
+	return level
+}
+
+func (repo *Repo) GetWorkflowInterfaceChangesSince(tag string) ([]InterfaceChange, error) {
+	changes, err := repo.GetChangesSince(tag, WorkflowsDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	interfaceChanges := []InterfaceChange{}
+	for _, change := range changes {
+		if extension := filepath.Ext(change.Path); extension != ".yaml" && extension != ".yml" {
+			continue
+		}
+
+		var previous, current *WorkflowInterface
+		if change.Status != "added" {
+			contents, err := repo.GetFileAt(tag, change.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			if previous, err = ParseWorkflowInterface(contents); err != nil {
+				return nil, fmt.Errorf("could not get interface of '%s' at '%s': %w", change.Path, tag, err)
+			}
+		}
+		if change.Status != "removed" {
+			contents, err := repo.GetFileAt("HEAD", change.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			if current, err = ParseWorkflowInterface(contents); err != nil {
+				return nil, fmt.Errorf("could not get interface of '%s': %w", change.Path, err)
+			}
+		}
+
+		interfaceChanges = append(interfaceChanges, CompareWorkflowInterfaces(change.Path, previous, current)...)
+	}
+
+	return interfaceChanges, nil
+}
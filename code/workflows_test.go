@@ -0,0 +1,209 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseWorkflowInterface(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected *WorkflowInterface
+	}{
+		{"not callable", "on:\n  push:\n    branches: [main]\n", nil},
+		{"event name", "on: workflow_call\n", &WorkflowInterface{}},
+		{"list of events", "on: [push, workflow_call]\n", &WorkflowInterface{}},
+		{
+			name:     "inputs, outputs and secrets",
+			contents: "on:\n  push:\n  workflow_call:\n    inputs:\n      go-version:\n        type: string\n        default: stable\n      go-file-path:\n        type: string\n        required: true\n    outputs:\n      go-output:\n        value: ${{ jobs.run.outputs.go-output }}\n    secrets:\n      GH_PAT:\n        required: true\n",
+			expected: &WorkflowInterface{
+				Inputs: map[string]WorkflowInput{
+					"go-version":   {Type: "string", Default: "stable"},
+					"go-file-path": {Type: "string", Required: true},
+				},
+				Outputs: map[string]WorkflowOutput{"go-output": {Value: "${{ jobs.run.outputs.go-output }}"}},
+				Secrets: map[string]WorkflowSecret{"GH_PAT": {Required: true}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			workflowInterface, err := ParseWorkflowInterface(test.contents)
+			if err != nil {
+				t.Fatalf("ParseWorkflowInterface() returned an error: %v", err)
+			}
+
+			if !reflect.DeepEqual(workflowInterface, test.expected) {
+				t.Errorf("ParseWorkflowInterface() = %+v, expected %+v", workflowInterface, test.expected)
+			}
+		})
+	}
+
+	if _, err := ParseWorkflowInterface("on: [\n"); err == nil {
+		t.Errorf("ParseWorkflowInterface() of invalid YAML did not return an error")
+	}
+}
+
+func TestCompareWorkflowInterfaces(t *testing.T) {
+	previous := &WorkflowInterface{
+		Inputs: map[string]WorkflowInput{
+			"go-version": {Type: "string", Default: "stable"},
+			"go-args":    {Type: "string", Required: true},
+		},
+		Outputs: map[string]WorkflowOutput{"go-output": {Value: "${{ jobs.run.outputs.go-output }}"}},
+		Secrets: map[string]WorkflowSecret{"GH_PAT": {}},
+	}
+	withChange := func(change func(current *WorkflowInterface)) *WorkflowInterface {
+		current := &WorkflowInterface{Inputs: map[string]WorkflowInput{}, Outputs: map[string]WorkflowOutput{}, Secrets: map[string]WorkflowSecret{}}
+		for name, input := range previous.Inputs {
+			current.Inputs[name] = input
+		}
+		for name, output := range previous.Outputs {
+			current.Outputs[name] = output
+		}
+		for name, secret := range previous.Secrets {
+			current.Secrets[name] = secret
+		}
+
+		change(current)
+		return current
+	}
+
+	tests := []struct {
+		name     string
+		previous *WorkflowInterface
+		current  *WorkflowInterface
+		expected []InterfaceChange
+	}{
+		{"not callable", nil, nil, []InterfaceChange{}},
+		{"unchanged", previous, withChange(func(current *WorkflowInterface) {}), []InterfaceChange{}},
+		{"now callable", nil, previous, []InterfaceChange{{"build.yaml", "workflow can now be called", BumpMinor}}},
+		{"no longer callable", previous, nil, []InterfaceChange{{"build.yaml", "workflow can no longer be called", BumpMajor}}},
+		{
+			name:     "added optional input",
+			previous: previous,
+			current:  withChange(func(current *WorkflowInterface) { current.Inputs["go-file-ref"] = WorkflowInput{Type: "string"} }),
+			expected: []InterfaceChange{{"build.yaml", "optional input `go-file-ref` was added", BumpMinor}},
+		},
+		{
+			name:     "added required input",
+			previous: previous,
+			current: withChange(func(current *WorkflowInterface) {
+				current.Inputs["go-file-ref"] = WorkflowInput{Type: "string", Required: true}
+			}),
+			expected: []InterfaceChange{{"build.yaml", "required input `go-file-ref` was added", BumpMajor}},
+		},
+		{
+			name:     "removed input",
+			previous: previous,
+			current:  withChange(func(current *WorkflowInterface) { delete(current.Inputs, "go-version") }),
+			expected: []InterfaceChange{{"build.yaml", "input `go-version` was removed", BumpMajor}},
+		},
+		{
+			name:     "newly required input",
+			previous: previous,
+			current: withChange(func(current *WorkflowInterface) {
+				current.Inputs["go-version"] = WorkflowInput{Type: "string", Required: true}
+			}),
+			expected: []InterfaceChange{{"build.yaml", "input `go-version` is now required", BumpMajor}},
+		},
+		{
+			name:     "retyped input",
+			previous: previous,
+			current: withChange(func(current *WorkflowInterface) {
+				current.Inputs["go-version"] = WorkflowInput{Type: "number", Default: "stable"}
+			}),
+			expected: []InterfaceChange{{"build.yaml", "input `go-version` changed type from `string` to `number`", BumpMajor}},
+		},
+		{
+			name:     "optional input and new default",
+			previous: previous,
+			current: withChange(func(current *WorkflowInterface) {
+				current.Inputs["go-args"] = WorkflowInput{Type: "string"}
+				current.Inputs["go-version"] = WorkflowInput{Type: "string", Default: "1.22"}
+			}),
+			expected: []InterfaceChange{
+				{"build.yaml", "input `go-args` is now optional", BumpPatch},
+				{"build.yaml", "input `go-version` changed its default to `1.22`", BumpPatch},
+			},
+		},
+		{
+			name:     "added and removed outputs",
+			previous: previous,
+			current: withChange(func(current *WorkflowInterface) {
+				delete(current.Outputs, "go-output")
+				current.Outputs["go-result"] = WorkflowOutput{Value: "${{ jobs.run.outputs.go-result }}"}
+			}),
+			expected: []InterfaceChange{
+				{"build.yaml", "output `go-output` was removed", BumpMajor},
+				{"build.yaml", "output `go-result` was added", BumpMinor},
+			},
+		},
+		{
+			name:     "added secrets",
+			previous: previous,
+			current: withChange(func(current *WorkflowInterface) {
+				current.Secrets["GH_APP_ID"] = WorkflowSecret{}
+				current.Secrets["GH_APP_PRIVATE_KEY"] = WorkflowSecret{Required: true}
+			}),
+			expected: []InterfaceChange{
+				{"build.yaml", "optional secret `GH_APP_ID` was added", BumpMinor},
+				{"build.yaml", "required secret `GH_APP_PRIVATE_KEY` was added", BumpMajor},
+			},
+		},
+		{
+			name:     "removed secret",
+			previous: previous,
+			current:  withChange(func(current *WorkflowInterface) { delete(current.Secrets, "GH_PAT") }),
+			expected: []InterfaceChange{{"build.yaml", "secret `GH_PAT` was removed", BumpMajor}},
+		},
+		{
+			name:     "newly required secret",
+			previous: previous,
+			current:  withChange(func(current *WorkflowInterface) { current.Secrets["GH_PAT"] = WorkflowSecret{Required: true} }),
+			expected: []InterfaceChange{{"build.yaml", "secret `GH_PAT` is now required", BumpMajor}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := CompareWorkflowInterfaces("build.yaml", test.previous, test.current)
+			if !reflect.DeepEqual(changes, test.expected) {
+				t.Errorf("CompareWorkflowInterfaces() = %+v, expected %+v", changes, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetWorkflowInterfaceChangesSince(t *testing.T) {
+	backend := NewMemoryGit()
+	backend.AddRemote("memory://org/common", "main", map[string]string{
+		".github/workflows/run-go-file.yaml": "on:\n  workflow_call:\n    inputs:\n      go-file-path:\n        type: string\n",
+	})
+
+	repo := &Repo{Dir: t.TempDir(), Backend: backend, RemoteURL: func(repo string) string { return "memory://" + repo }}
+	if err := repo.Clone("org/common", "main"); err != nil {
+		t.Fatalf("Clone() returned an error: %v", err)
+	}
+	if err := repo.AddTag("v1.0.0"); err != nil {
+		t.Fatalf("AddTag() returned an error: %v", err)
+	}
+
+	writeFiles(t, repo.Dir, map[string]string{
+		".github/workflows/run-go-file.yaml": "on:\n  workflow_call:\n    inputs:\n      go-file-path:\n        type: string\n      go-args:\n        type: string\n",
+	})
+	if err := repo.CommitAndPush("main", []string{"."}); err != nil {
+		t.Fatalf("CommitAndPush() returned an error: %v", err)
+	}
+
+	// Changes that were not committed are not part of the release.
+	writeFiles(t, repo.Dir, map[string]string{".github/workflows/run-go-file.yaml": "on: push\n"})
+
+	changes, err := repo.GetWorkflowInterfaceChangesSince("v1.0.0")
+	expected := []InterfaceChange{{".github/workflows/run-go-file.yaml", "optional input `go-args` was added", BumpMinor}}
+	if err != nil || !reflect.DeepEqual(changes, expected) {
+		t.Errorf("GetWorkflowInterfaceChangesSince() = %+v (%v), expected %+v", changes, err, expected)
+	}
+}
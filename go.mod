@@ -2,6 +2,9 @@ module github.com/workflow-sync-poc/common
 
 go 1.22.5
 
-require github.com/google/go-github/v62 v62.0.0
+require (
+	github.com/google/go-github/v62 v62.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require github.com/google/go-querystring v1.1.0 // indirect